@@ -4,9 +4,14 @@ import (
 	"compress/flate"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"plex_monitor/internal/database"
+	"plex_monitor/internal/utils"
 	"plex_monitor/internal/web/api/controllers/firehose"
+	"plex_monitor/internal/web/api/controllers/thumbnail"
 	"plex_monitor/internal/web/api/controllers/user"
 	"plex_monitor/internal/web/api/controllers/webhook"
 
@@ -35,6 +40,7 @@ func routes() *chi.Mux {
 		)
 
 		r.Mount("/firehose", firehose.Routes())
+		r.Mount("/thumbnails", thumbnail.Routes())
 		r.Mount("/users", user.Routes())
 		r.Mount("/webhook", webhook.Routes())
 
@@ -65,6 +71,67 @@ func main() {
 	router := routes()
 	database.InitDB(os.Getenv("DATABASE_URL"), os.Getenv("DATABASE_NAME"))
 
+	// Wrap the events stored before the event envelope, which the firehose and the indexes expect
+	wrapped, err := webhook.WrapLegacyEvents()
+	if err != nil {
+		logrus.WithError(err).Error("Could not wrap all the events stored before the event envelope")
+	}
+	if wrapped > 0 {
+		logrus.Infof("Wrapped %d event(s) stored before the event envelope", wrapped)
+	}
+
+	// Webhooks with the same payload received within this window are only stored once
+	if dedupWindow := os.Getenv("DEDUP_WINDOW"); dedupWindow != "" {
+		window, err := time.ParseDuration(dedupWindow)
+		if err != nil {
+			logrus.Fatalf("Invalid DEDUP_WINDOW: %s", err)
+		}
+		webhook.DedupWindow = window
+	}
+
+	// Redact secrets from the stored raw requests, optionally keeping an encrypted copy of them as they were received
+	webhook.Redaction.Headers = append(webhook.Redaction.Headers, splitList(os.Getenv("REDACT_HEADERS"))...)
+	webhook.Redaction.QueryParams = append(webhook.Redaction.QueryParams, splitList(os.Getenv("REDACT_QUERY_PARAMS"))...)
+	webhook.Redaction.JSONPaths = append(webhook.Redaction.JSONPaths, splitList(os.Getenv("REDACT_JSON_PATHS"))...)
+	if maskIPs := os.Getenv("REDACT_IPS"); maskIPs != "" {
+		webhook.Redaction.MaskIPs, _ = strconv.ParseBool(maskIPs)
+	}
+	if encodedKey := os.Getenv("WIRE_ENCRYPTION_KEY"); encodedKey != "" {
+		key, err := utils.ParseEncryptionKey(encodedKey)
+		if err != nil {
+			logrus.Fatalf("Invalid WIRE_ENCRYPTION_KEY: %s", err)
+		}
+		webhook.WireEncryptionKey = key
+	}
+
+	// Accept webhooks as soon as they are on disk, so they survive database outages. The workers start right away, so
+	// this comes after the dedup, redaction and encryption settings they use.
+	if spoolDir := os.Getenv("SPOOL_DIR"); spoolDir != "" {
+		workers, _ := strconv.Atoi(os.Getenv("SPOOL_WORKERS"))
+		if retention := os.Getenv("SPOOL_FAILED_RETENTION"); retention != "" {
+			var err error
+			webhook.SpoolFailedRetention, err = time.ParseDuration(retention)
+			if err != nil {
+				logrus.Fatalf("Invalid SPOOL_FAILED_RETENTION: %s", err)
+			}
+		}
+		if _, err := webhook.StartSpool(spoolDir, workers); err != nil {
+			logrus.Fatal(err)
+		}
+		logrus.Infof("Spooling webhooks in %s", spoolDir)
+	}
+
+	// Remove the raw requests that the retention policies of their services no longer keep
+	sweepInterval := webhook.DefaultWireSweepInterval
+	if interval := os.Getenv("WIRE_SWEEP_INTERVAL"); interval != "" {
+		var err error
+		sweepInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			logrus.Fatalf("Invalid WIRE_SWEEP_INTERVAL: %s", err)
+		}
+	}
+	webhook.StartWireSweeper(sweepInterval)
+
 	logrus.Info("Starting Plex Monitor Web...")
 
 	walkFunc := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
@@ -77,3 +144,14 @@ func main() {
 
 	logrus.Fatal(http.ListenAndServe(":8080", router)) // Note, the port is usually gotten from the environment.
 }
+
+// splitList splits the comma separated list from an environment variable, ignoring empty entries.
+func splitList(list string) []string {
+	entries := []string{}
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -62,6 +62,7 @@ func GetCliApp() *cli.App {
 				Usage:   "🫳 Fetches an object from the system",
 				Subcommands: []*cli.Command{
 					getDumpWireFileCmd(),
+					getRawWireCmd(),
 				},
 			},
 			{
@@ -70,6 +71,10 @@ func GetCliApp() *cli.App {
 				Usage:   "📝 Lists objects from the system",
 				Subcommands: []*cli.Command{
 					getListFilesCmd(),
+					getListServicesCmd(),
+					getListDriftCmd(),
+					getListHealthCmd(),
+					getListStorageCmd(),
 				},
 			},
 			{
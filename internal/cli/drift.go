@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"plex_monitor/internal/database/models"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func getListDriftCmd() *cli.Command {
+	return &cli.Command{
+		Name:    "drift",
+		Aliases: []string{"d"},
+		Usage:   "Lists the fields services sent that the models don't decode",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "service", Required: false, Usage: "Only list the fields sent by this service (e.g. sonarr)"},
+		},
+		Action: func(cCtx *cli.Context) error {
+			filter := bson.M{}
+			if service := cCtx.String("service"); service != "" {
+				filter["serviceName"] = service
+			}
+
+			drift, err := models.GetSchemaDrift(filter)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			for _, d := range drift {
+				example, _ := json.Marshal(d.ExampleValue)
+				fmt.Printf("%s\t%s\t%s\t%d time(s)\t%s - %s\t%s\n", d.ServiceName, d.EventType, d.Field, d.Count, d.FirstSeen.Format(time.RFC3339), d.LastSeen.Format(time.RFC3339), example)
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"fmt"
+	"plex_monitor/internal/database/models"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func getListHealthCmd() *cli.Command {
+	return &cli.Command{
+		Name:    "health",
+		Aliases: []string{"hl"},
+		Usage:   "Lists the health issues of the Servarr applications, most recently opened first",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "service", Required: false, Usage: "Only list the issues of this service (e.g. sonarr)"},
+			&cli.BoolFlag{Name: "open", Required: false, Usage: "Only list the issues that are still open"},
+			&cli.Int64Flag{Name: "limit", Value: 100, Usage: "The maximum number of issues to list, 0 lists all of them"},
+		},
+		Action: func(cCtx *cli.Context) error {
+			filter := bson.M{}
+			if service := cCtx.String("service"); service != "" {
+				filter["serviceName"] = service
+			}
+			if cCtx.Bool("open") {
+				filter["open"] = true
+			}
+
+			issues, err := models.GetHealthIssues(filter, cCtx.Int64("limit"))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			now := time.Now()
+			for _, issue := range issues {
+				issue = issue.WithDuration(now)
+				status := "closed"
+				if issue.Open {
+					status = "open"
+				}
+				fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", issue.ServiceName, issue.Instance, status, issue.Level, issue.Type, issue.OpenedAt.Format(time.RFC3339), time.Duration(issue.DurationSeconds)*time.Second, issue.Message)
+			}
+
+			return nil
+		},
+	}
+}
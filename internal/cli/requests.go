@@ -7,10 +7,12 @@ import (
 	"os"
 	"path/filepath"
 	"plex_monitor/internal/database/models"
+	"plex_monitor/internal/utils"
 	"strings"
 
 	"github.com/urfave/cli/v2"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func getDumpWireFileCmd() *cli.Command {
@@ -77,6 +79,65 @@ func getDumpWireFileCmd() *cli.Command {
 	}
 }
 
+func getRawWireCmd() *cli.Command {
+	return &cli.Command{
+		Name:    "wire",
+		Aliases: []string{"w"},
+		Usage:   "Prints the raw request a firehose entry was parsed from",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "event", Required: false, Usage: "ID of the firehose entry"},
+			&cli.StringFlag{Name: "id", Required: false, Usage: "ID of the raw request"},
+			&cli.BoolFlag{Name: "unredacted", Required: false, Usage: "Print the request as it was received, decrypted with WIRE_ENCRYPTION_KEY"},
+		},
+		Action: func(cCtx *cli.Context) error {
+			event := cCtx.String("event")
+			id := cCtx.String("id")
+
+			if (event == "") == (id == "") {
+				return cli.Exit("Either event or id must be set", 1)
+			}
+
+			if event != "" {
+				eventID, err := primitive.ObjectIDFromHex(event)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Invalid event ID: %s", err), 1)
+				}
+
+				rawWireID, err := models.GetRawWireIDForEvent(eventID)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+				id = rawWireID.Hex()
+			}
+
+			rawWireID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Invalid raw request ID: %s", err), 1)
+			}
+
+			var wire []byte
+			if cCtx.Bool("unredacted") {
+				key, err := utils.ParseEncryptionKey(os.Getenv("WIRE_ENCRYPTION_KEY"))
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Invalid WIRE_ENCRYPTION_KEY: %s", err), 1)
+				}
+				wire, err = models.GetUnredactedRawWire(rawWireID, key)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+			} else {
+				wire, err = models.GetRawWire(rawWireID)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+			}
+
+			fmt.Print(string(wire))
+			return nil
+		},
+	}
+}
+
 func getListFilesCmd() *cli.Command {
 	return &cli.Command{
 		Name:    "requests",
@@ -98,6 +159,13 @@ func getListFilesCmd() *cli.Command {
 	}
 }
 
+// The webhook key parameters and the replay header of the webhook entrypoint
+const (
+	replayKeyQueryParam = "key"
+	replayKeyHeader     = "X-Webhook-Key"
+	replayHeader        = "X-Webhook-Replay"
+)
+
 func getReplayWireFileCmd() *cli.Command {
 	readRequest := func(raw, scheme string) (*http.Request, error) {
 		r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
@@ -115,11 +183,13 @@ func getReplayWireFileCmd() *cli.Command {
 			&cli.StringFlag{Name: "filename"},
 			&cli.StringFlag{Name: "filter", Required: false, Usage: "Partial matches of filename"},
 			&cli.StringFlag{Name: "host", Required: false, Usage: "Override the host header"},
+			&cli.StringFlag{Name: "key", Required: false, Usage: "Webhook key to authenticate with, since stored requests have theirs redacted"},
 		},
 		Action: func(cCtx *cli.Context) error {
 			filename := cCtx.String("filename")
 			filter := cCtx.String("filter")
 			host := cCtx.String("host")
+			key := cCtx.String("key")
 
 			if filename == "" && filter == "" {
 				return cli.Exit("Filename or filter must be set", 1)
@@ -185,8 +255,25 @@ func getReplayWireFileCmd() *cli.Command {
 					fmt.Println("  Overriding host header with:", host)
 				}
 
+				// Authenticate with the supplied key rather than the redacted one
+				if key != "" {
+					query := req.URL.Query()
+					query.Del(replayKeyQueryParam)
+					req.URL.RawQuery = query.Encode()
+					req.Header.Set(replayKeyHeader, key)
+				}
+
+				// Replays are stored again, even though the request is a duplicate of the one that was stored
+				req.Header.Set(replayHeader, "true")
+
 				// Execute the request
-				new(http.Client).Do(req)
+				resp, err := new(http.Client).Do(req)
+				if err != nil {
+					fmt.Println("  Could not replay request:", err)
+					continue
+				}
+				resp.Body.Close()
+				fmt.Println("  Response:", resp.Status)
 			}
 
 			return nil
@@ -1,14 +1,49 @@
 package cli
 
-import "github.com/urfave/cli/v2"
+import (
+	"encoding/json"
+	"fmt"
+	"plex_monitor/internal/database/models"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
 
 func getServiceCreateCmd() *cli.Command {
 	return &cli.Command{
 		Name:    "new",
 		Aliases: []string{"n"},
 		Usage:   "Configure a new key in the system. Returns the unique key for the service",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "name", Required: true, Usage: "Human readable name of the service"},
+			&cli.StringFlag{Name: "type", Required: true, Usage: "Type of the service, matches the ?service= webhook parameter (e.g. sonarr)"},
+			&cli.StringFlag{Name: "instance", Required: false, Usage: "Label for this instance of the service (e.g. 4k)"},
+			&cli.StringFlag{Name: "config", Required: false, Usage: "JSON object with service specific configuration"},
+			&cli.BoolFlag{Name: "custom", Required: false, Usage: "Allow a type that isn't built in, for a service registered from a separate package"},
+		},
 		Action: func(cCtx *cli.Context) error {
-			//
+			// A service of a type the webhook entrypoint doesn't know could never authenticate a webhook
+			serviceType := cCtx.String("type")
+			if !cCtx.Bool("custom") && !models.IsServiceType(serviceType) {
+				return cli.Exit(fmt.Sprintf("Unknown service type %q, expected one of: %s (or use --custom)", serviceType, strings.Join(models.ServiceTypes, ", ")), 1)
+			}
+
+			config := bson.M{}
+			if rawConfig := cCtx.String("config"); rawConfig != "" {
+				if err := json.Unmarshal([]byte(rawConfig), &config); err != nil {
+					return cli.Exit(fmt.Sprintf("Config must be a JSON object: %s", err), 1)
+				}
+			}
+
+			service, key, err := models.CreateService(cCtx.String("name"), serviceType, cCtx.String("instance"), config, models.SystemUserID)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			fmt.Printf("Created service %s (%s) with ID %s\n", service.ServiceName, service.ServiceType, service.ID)
+			fmt.Printf("Webhook key (this will not be shown again): %s\n", key)
 			return nil
 		},
 	}
@@ -19,8 +54,50 @@ func getServiceKeyRotateCmd() *cli.Command {
 		Name:    "rotate",
 		Aliases: []string{"r"},
 		Usage:   "Rotates a key for a service",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "id", Required: true, Usage: "ID of the service to rotate the key for"},
+			&cli.DurationFlag{Name: "grace", Value: 24 * time.Hour, Usage: "How long the old key(s) stay valid after rotation"},
+		},
 		Action: func(cCtx *cli.Context) error {
-			//
+			service, err := models.GetService(cCtx.String("id"))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			key, expiresAt, err := service.RotateKey(cCtx.Duration("grace"), models.SystemUserID)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			fmt.Printf("Rotated key for service %s (%s), previous keys expire at %s\n", service.ServiceName, service.ID, expiresAt.Format(time.RFC3339))
+			fmt.Printf("Webhook key (this will not be shown again): %s\n", key)
+			return nil
+		},
+	}
+}
+
+func getListServicesCmd() *cli.Command {
+	return &cli.Command{
+		Name:    "services",
+		Aliases: []string{"s"},
+		Usage:   "Lists the services configured in the system",
+		Action: func(cCtx *cli.Context) error {
+			services, err := models.GetAllServices()
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			now := time.Now()
+			for _, service := range services {
+				activeKeys := 0
+				for _, k := range service.Keys {
+					if k.IsActive(now) {
+						activeKeys++
+					}
+				}
+				fmt.Printf("%s\t%s\t%s\t%s\t%d active key(s)\n", service.ID, service.ServiceType, service.ServiceName, service.Instance, activeKeys)
+			}
+
 			return nil
 		},
 	}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+	"plex_monitor/internal/database/models"
+
+	"github.com/urfave/cli/v2"
+)
+
+func getListStorageCmd() *cli.Command {
+	return &cli.Command{
+		Name:    "storage",
+		Aliases: []string{"st"},
+		Usage:   "Lists the storage used by the raw requests of each service",
+		Action: func(cCtx *cli.Context) error {
+			usage, err := models.GetRawWireUsage()
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			var files, storedSize, size int64
+			for _, u := range usage {
+				fmt.Printf("%s\t%d request(s)\t%s stored\t%s uncompressed\n", u.Service, u.Files, formatBytes(u.StoredSize), formatBytes(u.Size))
+				files += u.Files
+				storedSize += u.StoredSize
+				size += u.Size
+			}
+			fmt.Printf("total\t%d request(s)\t%s stored\t%s uncompressed\n", files, formatBytes(storedSize), formatBytes(size))
+
+			return nil
+		},
+	}
+}
+
+// formatBytes formats the size in bytes with a binary unit, e.g. 1.5 MiB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
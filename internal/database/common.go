@@ -3,4 +3,17 @@ package database
 const (
 	// WebhookCollectionName is the name of the collection for the webhook data
 	WebhookCollectionName = "webhook_data"
+	// ServicesCollectionName is the name of the collection for the configured services
+	ServicesCollectionName = "services"
+	// DedupCollectionName is the name of the collection for the hashes of recently stored webhooks
+	DedupCollectionName = "webhook_dedup"
+	// SchemaDriftCollectionName is the name of the collection for the fields services send that the models don't decode
+	SchemaDriftCollectionName = "schema_drift"
+	// HealthIssuesCollectionName is the name of the collection for the failing health checks of the Servarr applications
+	HealthIssuesCollectionName = "health_issues"
+	// HealthRestoresCollectionName is the name of the collection for the last time each health check of the Servarr
+	// applications passed again
+	HealthRestoresCollectionName = "health_restores"
+	// ThumbnailFilesCollectionName is the name of the files collection of the GridFS bucket for the thumbnails
+	ThumbnailFilesCollectionName = "thumbnails.files"
 )
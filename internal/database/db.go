@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
@@ -36,23 +37,117 @@ func InitDB(dataSourceName string, dbName string) {
 
 // setupIndexes sets up the indexes for the database
 func setupIndexes() {
-	// Setup index on created_at
+	// Setup index on the time the events were received
 	indexModel := mongo.IndexModel{
-		Keys: bson.D{{Key: "createdAt", Value: -1}},
+		Keys: bson.D{{Key: "receivedAt", Value: -1}},
 	}
 	_, err := DB.Collection(WebhookCollectionName).Indexes().CreateOne(Ctx, indexModel)
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
-	// Setup index on serviceName
+	// Setup index on the service that sent the events
 	indexModel = mongo.IndexModel{
-		Keys: bson.D{{Key: "serviceName", Value: 1}},
+		Keys: bson.D{{Key: "service", Value: 1}},
 	}
 	_, err = DB.Collection(WebhookCollectionName).Indexes().CreateOne(Ctx, indexModel)
 	if err != nil {
 		logrus.Fatal(err)
 	}
+
+	// Setup index on the normalized category of the events, newest first
+	indexModel = mongo.IndexModel{
+		Keys: bson.D{{Key: "category", Value: 1}, {Key: "receivedAt", Value: -1}},
+	}
+	_, err = DB.Collection(WebhookCollectionName).Indexes().CreateOne(Ctx, indexModel)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	// Setup unique index on the dedup hash
+	indexModel = mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err = DB.Collection(DedupCollectionName).Indexes().CreateOne(Ctx, indexModel)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	// Setup TTL index on the dedup expiry, so claims are removed once they expire
+	indexModel = mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	_, err = DB.Collection(DedupCollectionName).Indexes().CreateOne(Ctx, indexModel)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	// Setup unique index on the unknown fields per service and event type
+	indexModel = mongo.IndexModel{
+		Keys:    bson.D{{Key: "serviceName", Value: 1}, {Key: "eventType", Value: 1}, {Key: "field", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err = DB.Collection(SchemaDriftCollectionName).Indexes().CreateOne(Ctx, indexModel)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	// Setup unique index on the open health issues, so a failing health check only has one open issue
+	indexModel = mongo.IndexModel{
+		Keys:    bson.D{{Key: "serviceName", Value: 1}, {Key: "instance", Value: 1}, {Key: "type", Value: 1}, {Key: "message", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"open": true}),
+	}
+	_, err = DB.Collection(HealthIssuesCollectionName).Indexes().CreateOne(Ctx, indexModel)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	// Setup index on the time the health issues were opened
+	indexModel = mongo.IndexModel{
+		Keys: bson.D{{Key: "openedAt", Value: -1}},
+	}
+	_, err = DB.Collection(HealthIssuesCollectionName).Indexes().CreateOne(Ctx, indexModel)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	// Setup index on the fingerprints of the webhook keys, which the services are looked up by
+	indexModel = mongo.IndexModel{
+		Keys: bson.D{{Key: "service_type", Value: 1}, {Key: "keys.fingerprint", Value: 1}},
+	}
+	_, err = DB.Collection(ServicesCollectionName).Indexes().CreateOne(Ctx, indexModel)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	// Setup unique index on the thumbnail hashes, so concurrent webhooks with the same thumbnail store it once
+	indexModel = mongo.IndexModel{
+		Keys:    bson.D{{Key: "filename", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err = DB.Collection(ThumbnailFilesCollectionName).Indexes().CreateOne(Ctx, indexModel)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	// Setup unique index on the health check restores, so only the last restore of a health check is kept
+	indexModel = mongo.IndexModel{
+		Keys:    bson.D{{Key: "serviceName", Value: 1}, {Key: "instance", Value: 1}, {Key: "type", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err = DB.Collection(HealthRestoresCollectionName).Indexes().CreateOne(Ctx, indexModel)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// Ping checks that the database can be reached, giving up after the supplied timeout.
+func Ping(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(Ctx, timeout)
+	defer cancel()
+	return DB.Client().Ping(ctx, readpref.PrimaryPreferred())
 }
 
 // CloseDB closes the database connection
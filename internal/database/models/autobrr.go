@@ -0,0 +1,122 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// AutobrrActionResultMatched is the action result of an announce that matched a filter, as posted by the webhook
+	// action of the filter
+	AutobrrActionResultMatched = "MATCHED"
+)
+
+// AutobrrWebhookData is the struct that represents an Autobrr release. It is either posted by the webhook action of a
+// filter using the recommended template from the README, or by a notification in the Notifiarr format, which carries
+// the result of pushing the release to the client (PUSH_APPROVED, PUSH_REJECTED, PUSH_ERROR).
+type AutobrrWebhookData struct {
+	FilterName   string      `json:"filterName" bson:"filterName"`
+	Indexer      string      `json:"indexer" bson:"indexer"`
+	ReleaseTitle string      `json:"releaseTitle" bson:"releaseTitle"`
+	Size         FlexibleInt `json:"size" bson:"size"`
+	DownloadID   string      `json:"downloadId,omitempty" bson:"downloadId,omitempty"`
+	Protocol     string      `json:"protocol" bson:"protocol"`
+	ActionType   string      `json:"actionType,omitempty" bson:"actionType,omitempty"`
+	ActionClient string      `json:"actionClient,omitempty" bson:"actionClient,omitempty"`
+	ActionResult string      `json:"actionResult" bson:"actionResult"`
+	Rejections   []string    `json:"rejections,omitempty" bson:"rejections,omitempty"`
+
+	// Notifiarr formatted notifications wrap the release in "data"
+	Event        string                   `json:"event,omitempty" bson:"-"`
+	Notification *AutobrrNotificationData `json:"data,omitempty" bson:"-"`
+
+	ServiceName string    `json:"serviceName" bson:"serviceName"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// AutobrrNotificationData is the struct that represents the "data" object of a Notifiarr formatted notification.
+type AutobrrNotificationData struct {
+	Event        string   `json:"event"`
+	ReleaseName  string   `json:"release_name"`
+	Filter       string   `json:"filter"`
+	Indexer      string   `json:"indexer"`
+	InfoHash     string   `json:"infohash"`
+	Size         int64    `json:"size"`
+	Status       string   `json:"status"`
+	ActionType   string   `json:"action_type"`
+	ActionClient string   `json:"action_client"`
+	Rejections   []string `json:"rejections"`
+	Protocol     string   `json:"protocol"`
+}
+
+// ToJSON converts the struct to JSON
+func (p *AutobrrWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct
+func (p *AutobrrWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts the HTTP request to struct
+func (p *AutobrrWebhookData) FromHTTPRequest(r *http.Request) error {
+	err := json.NewDecoder(r.Body).Decode(p)
+	if err != nil {
+		return err
+	}
+
+	if p.Notification != nil {
+		p.fromNotification()
+	}
+	if p.ReleaseTitle == "" {
+		return fmt.Errorf("missing release title")
+	}
+	if p.ActionResult == "" {
+		p.ActionResult = AutobrrActionResultMatched
+	}
+	// Torrent hashes are stored like the Servarr applications report them in downloadId
+	p.DownloadID = strings.ToUpper(p.DownloadID)
+
+	p.ServiceName = "autobrr"
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p AutobrrWebhookData) Envelope() EventEnvelope {
+	return EventEnvelope{
+		Service:   p.ServiceName,
+		Category:  EventCategoryGrab,
+		Action:    normalizeAction(p.ActionResult),
+		EventType: p.ActionResult,
+	}
+}
+
+// fromNotification fills in the fields from the Notifiarr formatted notification.
+func (p *AutobrrWebhookData) fromNotification() {
+	n := p.Notification
+	p.FilterName = n.Filter
+	p.Indexer = n.Indexer
+	p.ReleaseTitle = n.ReleaseName
+	p.Size = FlexibleInt(n.Size)
+	p.DownloadID = n.InfoHash
+	p.Protocol = n.Protocol
+	p.ActionType = n.ActionType
+	p.ActionClient = n.ActionClient
+	p.Rejections = n.Rejections
+	p.ActionResult = n.Status
+	if p.ActionResult == "" {
+		p.ActionResult = n.Event
+	}
+	if p.ActionResult == "" {
+		p.ActionResult = p.Event
+	}
+}
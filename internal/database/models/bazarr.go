@@ -0,0 +1,220 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"plex_monitor/internal/database"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// BazarrActionNotFound is the action of a notification about a subtitle search that found nothing
+	BazarrActionNotFound = "not found"
+)
+
+var (
+	// "Doctor Who (1963) - S16E02 - The Pirate Planet" or "Big Daddy (1999)", followed by " : <message>"
+	bazarrEpisodeRegex = regexp.MustCompile(`^(.+?) \(([^)]*)\) - S(\d+)E(\d+) - (.*)$`)
+	bazarrMovieRegex   = regexp.MustCompile(`^(.+?) \(([^)]*)\)$`)
+	// "English HI subtitles downloaded from opensubtitles with a score of 96.67%."
+	bazarrSubtitleRegex = regexp.MustCompile(`^(.+?) subtitles (.+?) from (.+?) with a score of ([\d.]+)%`)
+)
+
+// BazarrWebhookData is the struct that represents a Bazarr notification. Bazarr notifies through Apprise, so the JSON
+// webhook only carries a title, message and type; the subtitle details are parsed from the message. Senders that
+// already know the details can post them directly using the same field names.
+type BazarrWebhookData struct {
+	Version string `json:"version,omitempty" bson:"version,omitempty"`
+	Title   string `json:"title" bson:"title"`
+	Message string `json:"message" bson:"message"`
+	Type    string `json:"type" bson:"type"`
+
+	Action          string  `json:"action" bson:"action"`
+	MediaType       string  `json:"mediaType" bson:"mediaType"`
+	Language        string  `json:"language" bson:"language"`
+	HearingImpaired bool    `json:"hearingImpaired" bson:"hearingImpaired"`
+	Forced          bool    `json:"forced" bson:"forced"`
+	Provider        string  `json:"provider" bson:"provider"`
+	Score           float64 `json:"score" bson:"score"`
+
+	SeriesTitle     string `json:"seriesTitle,omitempty" bson:"seriesTitle,omitempty"`
+	SeasonNumber    int    `json:"seasonNumber,omitempty" bson:"seasonNumber,omitempty"`
+	EpisodeNumber   int    `json:"episodeNumber,omitempty" bson:"episodeNumber,omitempty"`
+	EpisodeTitle    string `json:"episodeTitle,omitempty" bson:"episodeTitle,omitempty"`
+	MovieTitle      string `json:"movieTitle,omitempty" bson:"movieTitle,omitempty"`
+	Year            int    `json:"year,omitempty" bson:"year,omitempty"`
+	SonarrSeriesID  int    `json:"sonarrSeriesId,omitempty" bson:"sonarrSeriesId,omitempty"`
+	SonarrEpisodeID int    `json:"sonarrEpisodeId,omitempty" bson:"sonarrEpisodeId,omitempty"`
+	RadarrID        int    `json:"radarrId,omitempty" bson:"radarrId,omitempty"`
+
+	ServiceName string    `json:"serviceName" bson:"serviceName"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// ToJSON converts the struct to JSON
+func (p *BazarrWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct
+func (p *BazarrWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts the HTTP request to struct
+func (p *BazarrWebhookData) FromHTTPRequest(r *http.Request) error {
+	err := json.NewDecoder(r.Body).Decode(p)
+	if err != nil {
+		return err
+	}
+	if p.Language == "" {
+		p.parseMessage()
+	}
+	p.ServiceName = "bazarr"
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope. Downloaded subtitles count as imports.
+func (p BazarrWebhookData) Envelope() EventEnvelope {
+	envelope := EventEnvelope{
+		Service:   p.ServiceName,
+		Category:  EventCategoryOther,
+		Action:    normalizeAction(p.Action),
+		EventType: p.Action,
+	}
+	if p.Action != "" && p.Action != BazarrActionNotFound {
+		envelope.Category = EventCategoryImport
+	}
+
+	switch p.MediaType {
+	case "episode":
+		envelope.Media = &EventMedia{Type: p.MediaType, Title: p.EpisodeTitle, SeriesTitle: p.SeriesTitle, Year: p.Year}
+	case "movie":
+		envelope.Media = &EventMedia{Type: p.MediaType, Title: p.MovieTitle, Year: p.Year}
+	}
+	return envelope
+}
+
+// parseMessage fills in the subtitle and media details from the Apprise message, which looks like
+// "<series> (<year>) - S01E02 - <episode title> : <details>" for episodes and "<movie> (<year>) : <details>" for movies.
+func (p *BazarrWebhookData) parseMessage() {
+	subject, details, found := strings.Cut(p.Message, " : ")
+	if !found {
+		details = p.Message
+		subject = ""
+	}
+
+	if match := bazarrEpisodeRegex.FindStringSubmatch(subject); match != nil {
+		p.MediaType = "episode"
+		p.SeriesTitle = match[1]
+		p.Year, _ = strconv.Atoi(match[2])
+		p.SeasonNumber, _ = strconv.Atoi(match[3])
+		p.EpisodeNumber, _ = strconv.Atoi(match[4])
+		p.EpisodeTitle = match[5]
+	} else if match := bazarrMovieRegex.FindStringSubmatch(subject); match != nil {
+		p.MediaType = "movie"
+		p.MovieTitle = match[1]
+		p.Year, _ = strconv.Atoi(match[2])
+	}
+
+	if match := bazarrSubtitleRegex.FindStringSubmatch(details); match != nil {
+		p.Language = match[1]
+		if language, found := strings.CutSuffix(p.Language, " HI"); found {
+			p.Language, p.HearingImpaired = language, true
+		}
+		if language, found := strings.CutSuffix(p.Language, " forced"); found {
+			p.Language, p.Forced = language, true
+		}
+		p.Action = match[2]
+		p.Provider = match[3]
+		p.Score, _ = strconv.ParseFloat(match[4], 64)
+		return
+	}
+
+	lowerDetails := strings.ToLower(details)
+	if strings.Contains(lowerDetails, "no subtitles") || strings.Contains(lowerDetails, "not found") {
+		p.Action = BazarrActionNotFound
+	}
+}
+
+// ResolveServarrIDs looks up the Sonarr series and episode IDs, or the Radarr movie ID, of the media the
+// notification is about using the latest Sonarr/Radarr event for the same title. IDs that were posted are kept.
+func (p *BazarrWebhookData) ResolveServarrIDs() error {
+	opts := options.FindOne().SetSort(bson.D{{Key: "receivedAt", Value: -1}})
+
+	switch p.MediaType {
+	case "episode":
+		if p.SonarrSeriesID != 0 && p.SonarrEpisodeID != 0 {
+			return nil
+		}
+		filter := bson.M{"service": "sonarr", "payload.series.title": p.SeriesTitle}
+		var result struct {
+			Payload SonarrWebhookData `bson:"payload"`
+		}
+		err := database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, filter, opts).Decode(&result)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if p.SonarrSeriesID == 0 {
+			p.SonarrSeriesID = result.Payload.Series.ID
+		}
+
+		if p.SonarrEpisodeID != 0 {
+			return nil
+		}
+		filter = bson.M{
+			"service":           "sonarr",
+			"payload.series.id": p.SonarrSeriesID,
+			"payload.episodes":  bson.M{"$elemMatch": bson.M{"seasonNumber": p.SeasonNumber, "episodeNumber": p.EpisodeNumber}},
+		}
+		err = database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, filter, opts).Decode(&result)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, episode := range result.Payload.Episodes {
+			if episode.SeasonNumber == p.SeasonNumber && episode.EpisodeNumber == p.EpisodeNumber {
+				p.SonarrEpisodeID = episode.ID
+				break
+			}
+		}
+	case "movie":
+		if p.RadarrID != 0 {
+			return nil
+		}
+		filter := bson.M{"service": "radarr", "payload.movie.title": p.MovieTitle}
+		if p.Year != 0 {
+			filter["payload.movie.year"] = p.Year
+		}
+		var result struct {
+			Payload RadarrWebhookData `bson:"payload"`
+		}
+		err := database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, filter, opts).Decode(&result)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p.RadarrID = result.Payload.Movie.ID
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"plex_monitor/internal/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DedupClaimTimeout is how long a claim that wasn't committed blocks duplicates. A webhook is stored well within it,
+// so an uncommitted claim that is older belongs to a webhook that was lost, e.g. because the server crashed, and the
+// next copy of the webhook takes it over.
+const DedupClaimTimeout = time.Minute
+
+// DedupClaim records that a webhook with the given hash is being stored, so the same webhook is not stored again
+// until the claim expires. The claim is committed once the webhook was stored. Expired claims are removed by a TTL
+// index.
+type DedupClaim struct {
+	Hash           string    `json:"hash" bson:"hash"`
+	ServiceID      string    `json:"serviceId" bson:"serviceId"`
+	IdempotencyKey string    `json:"idempotencyKey,omitempty" bson:"idempotencyKey,omitempty"`
+	ExpiresAt      time.Time `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt      time.Time `json:"createdAt" bson:"createdAt"`
+	// Token identifies this claim of the hash, so only its holder commits or releases it
+	Token primitive.ObjectID `json:"token" bson:"token"`
+	// ClaimedAt is when the claim was stored, which can be long after the webhook was received if it was spooled
+	ClaimedAt time.Time `json:"claimedAt" bson:"claimedAt"`
+	Committed bool      `json:"committed" bson:"committed"`
+}
+
+// Claim stores the claim, and returns false if an unexpired claim with the same hash already exists, meaning the
+// webhook is a duplicate. Claims that weren't committed within DedupClaimTimeout are taken over.
+func (c *DedupClaim) Claim() (bool, error) {
+	collection := database.DB.Collection(database.DedupCollectionName)
+
+	c.Token = primitive.NewObjectID()
+	c.ClaimedAt = time.Now()
+	c.Committed = false
+
+	_, err := collection.InsertOne(context.Background(), c)
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, fmt.Errorf("could not store dedup claim: %w", err)
+	}
+
+	// Take over an expired claim that the TTL index, which runs once a minute, hasn't removed yet, or a claim of a
+	// webhook that was lost before it was stored
+	filter := bson.M{
+		"hash": c.Hash,
+		"$or": bson.A{
+			bson.M{"expiresAt": bson.M{"$lte": c.CreatedAt}},
+			bson.M{"committed": false, "claimedAt": bson.M{"$lte": c.ClaimedAt.Add(-DedupClaimTimeout)}},
+		},
+	}
+	result, err := collection.ReplaceOne(context.Background(), filter, c)
+	if err != nil {
+		return false, fmt.Errorf("could not store dedup claim: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// Commit marks the claim as committed once the webhook was stored, so it blocks duplicates until it expires.
+func (c *DedupClaim) Commit() error {
+	filter := bson.M{"hash": c.Hash, "token": c.Token}
+	_, err := database.DB.Collection(database.DedupCollectionName).UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"committed": true}})
+	if err != nil {
+		return fmt.Errorf("could not commit dedup claim: %w", err)
+	}
+	c.Committed = true
+	return nil
+}
+
+// Release removes the claim, so a webhook that could not be stored is not treated as a duplicate when it is retried.
+// A claim that was taken over by another copy of the webhook is left alone.
+func (c *DedupClaim) Release() error {
+	filter := bson.M{"hash": c.Hash, "token": c.Token}
+	_, err := database.DB.Collection(database.DedupCollectionName).DeleteOne(context.Background(), filter)
+	if err != nil {
+		return fmt.Errorf("could not release dedup claim: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// downloadClientFields are the names of the form fields each download client's completion script posts. They match
+// the names of the arguments, environment variables or parameters the client hands to the script.
+type downloadClientFields struct {
+	Hash        string
+	Name        string
+	Category    string
+	SavePath    string
+	ContentPath string
+	Size        string
+}
+
+var downloadClientFieldNames = map[string]downloadClientFields{
+	// Execute plugin arguments: torrent id, torrent name, download path
+	"deluge": {
+		Hash:     "torrent_id",
+		Name:     "torrent_name",
+		SavePath: "download_path",
+	},
+	// Environment variables of the "script-torrent-done-filename" script
+	"transmission": {
+		Hash:     "TR_TORRENT_HASH",
+		Name:     "TR_TORRENT_NAME",
+		Category: "TR_TORRENT_LABELS",
+		SavePath: "TR_TORRENT_DIR",
+		Size:     "TR_TORRENT_BYTES_DOWNLOADED",
+	},
+	// "Run external program on torrent finished" parameters: %I, %N, %L, %D, %F and %Z
+	"qbittorrent": {
+		Hash:        "hash",
+		Name:        "name",
+		Category:    "category",
+		SavePath:    "save_path",
+		ContentPath: "content_path",
+		Size:        "size",
+	},
+}
+
+// DownloadClientEvent is the struct that represents a torrent completion posted by the completion script of a
+// download client (Deluge, Transmission, qBittorrent). DownloadID is the upper case info hash, which is what the
+// Servarr applications report as the downloadId of a torrent.
+type DownloadClientEvent struct {
+	Client      string    `json:"client" bson:"client"`
+	DownloadID  string    `json:"downloadId" bson:"downloadId"`
+	Name        string    `json:"name" bson:"name"`
+	Category    string    `json:"category" bson:"category"`
+	SavePath    string    `json:"savePath" bson:"savePath"`
+	ContentPath string    `json:"contentPath,omitempty" bson:"contentPath,omitempty"`
+	Size        int64     `json:"size" bson:"size"`
+	ServiceName string    `json:"serviceName" bson:"serviceName"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+
+	// unknownFields are the posted form fields that aren't fields of the client, see UnknownFields
+	unknownFields map[string]interface{}
+}
+
+// UnknownFields returns the form fields posted with the event that aren't fields of the download client, by name with
+// the value that was posted.
+func (p DownloadClientEvent) UnknownFields() map[string]interface{} {
+	return p.unknownFields
+}
+
+// names returns the names of the form fields of the download client.
+func (f downloadClientFields) names() []string {
+	names := []string{}
+	for _, name := range []string{f.Hash, f.Name, f.Category, f.SavePath, f.ContentPath, f.Size} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ToJSON converts the struct to JSON
+func (p *DownloadClientEvent) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct
+func (p *DownloadClientEvent) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts the form posted by the completion script of the given client to struct
+func (p *DownloadClientEvent) FromHTTPRequest(r *http.Request, client string) error {
+	fields, ok := downloadClientFieldNames[client]
+	if !ok {
+		return fmt.Errorf("unknown download client: %s", client)
+	}
+
+	// FormValue parses both url encoded and multipart forms (curl -d and curl -F)
+	p.Client = client
+	p.DownloadID = strings.ToUpper(strings.TrimSpace(r.FormValue(fields.Hash)))
+	p.Name = r.FormValue(fields.Name)
+	p.SavePath = r.FormValue(fields.SavePath)
+	if fields.ContentPath != "" {
+		p.ContentPath = r.FormValue(fields.ContentPath)
+	}
+	if fields.Category != "" {
+		// Transmission sends a comma separated list of labels, the first one is used as the category
+		p.Category, _, _ = strings.Cut(r.FormValue(fields.Category), ",")
+	}
+	if fields.Size != "" && r.FormValue(fields.Size) != "" {
+		size, err := strconv.ParseInt(r.FormValue(fields.Size), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid size: %w", err)
+		}
+		p.Size = size
+	}
+
+	if p.DownloadID == "" {
+		return fmt.Errorf("missing torrent hash (%s)", fields.Hash)
+	}
+
+	p.unknownFields = unknownScriptFields(r.PostForm, fields.names())
+	p.ServiceName = client
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p DownloadClientEvent) Envelope() EventEnvelope {
+	return EventEnvelope{
+		Service:   p.ServiceName,
+		Category:  EventCategoryDownload,
+		Action:    "complete",
+		EventType: "complete",
+	}
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"plex_monitor/internal/database"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxDriftExampleSize is the size of the JSON encoded example value above which it is stored truncated.
+const maxDriftExampleSize = 1024
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// SchemaDrift is a field sent by a service that the model for its events doesn't decode.
+type SchemaDrift struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ServiceName  string             `json:"serviceName" bson:"serviceName"`
+	EventType    string             `json:"eventType" bson:"eventType"`
+	Field        string             `json:"field" bson:"field"`
+	ExampleValue interface{}        `json:"exampleValue" bson:"exampleValue"`
+	Count        int64              `json:"count" bson:"count"`
+	FirstSeen    time.Time          `json:"firstSeen" bson:"firstSeen"`
+	LastSeen     time.Time          `json:"lastSeen" bson:"lastSeen"`
+}
+
+// RecordSchemaDrift stores the unknown fields for the service and event type, with an example of their value, or
+// updates when they were last seen. All the fields are written in a single batch.
+func RecordSchemaDrift(serviceName string, eventType string, fields map[string]interface{}, at time.Time) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(fields))
+	for field, example := range fields {
+		update := bson.M{
+			"$setOnInsert": bson.M{"firstSeen": at},
+			"$set":         bson.M{"lastSeen": at, "exampleValue": driftExample(example)},
+			"$inc":         bson.M{"count": 1},
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"serviceName": serviceName, "eventType": eventType, "field": field}).
+			SetUpdate(update).
+			SetUpsert(true))
+	}
+
+	_, err := database.DB.Collection(database.SchemaDriftCollectionName).BulkWrite(context.Background(), writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("could not record schema drift: %w", err)
+	}
+	return nil
+}
+
+// GetSchemaDrift returns the unknown fields matching the filter, most recently seen first.
+func GetSchemaDrift(filter bson.M) ([]SchemaDrift, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "lastSeen", Value: -1}})
+	cursor, err := database.DB.Collection(database.SchemaDriftCollectionName).Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := []SchemaDrift{}
+	err = cursor.All(context.Background(), &drift)
+	if err != nil {
+		return nil, err
+	}
+	return drift, nil
+}
+
+// driftExample returns the example value to store, truncating large values.
+func driftExample(example interface{}) interface{} {
+	encoded, err := json.Marshal(example)
+	if err != nil {
+		return fmt.Sprint(example)
+	}
+	if len(encoded) > maxDriftExampleSize {
+		return string(encoded[:maxDriftExampleSize]) + "…"
+	}
+	if number, ok := example.(json.Number); ok {
+		return number.String()
+	}
+	return example
+}
+
+// UnknownJSONFields returns the fields of the JSON document that the model doesn't decode, by their path (e.g.
+// "series.tags" or "episodes[].finaleType") with the value that was sent. Only the outermost unknown field is
+// returned, not the fields nested in it.
+func UnknownJSONFields(raw []byte, model interface{}) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := map[string]interface{}{}
+	collectUnknownFields(value, reflect.TypeOf(model), "", unknown)
+	return unknown, nil
+}
+
+// collectUnknownFields adds the fields of the decoded JSON value that the type doesn't decode to unknown.
+func collectUnknownFields(value interface{}, t reflect.Type, path string, unknown map[string]interface{}) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	// Types that decode themselves accept any fields
+	if t.Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for key, v := range object {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+
+			// Like encoding/json, match the field names case-insensitively
+			fieldType, ok := fields[strings.ToLower(key)]
+			if !ok {
+				unknown[fieldPath] = v
+				continue
+			}
+			collectUnknownFields(v, fieldType, fieldPath, unknown)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for _, item := range items {
+			collectUnknownFields(item, t.Elem(), path+"[]", unknown)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, v := range object {
+			collectUnknownFields(v, t.Elem(), path+".*", unknown)
+		}
+	}
+}
+
+// jsonFields returns the types of the fields encoding/json decodes into the struct, by their lower case JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// Fields of embedded structs are decoded as if they were fields of the struct itself
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for embeddedName, embeddedType := range jsonFields(embedded) {
+					if _, ok := fields[embeddedName]; !ok {
+						fields[embeddedName] = embeddedType
+					}
+				}
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+	return fields
+}
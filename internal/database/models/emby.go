@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EmbyWebhookData is the struct that represents the data sent by Emby webhooks
+type EmbyWebhookData struct {
+	Title       string `json:"Title" bson:"Title"`
+	Description string `json:"Description" bson:"Description"`
+	Date        string `json:"Date" bson:"Date"`
+	Event       string `json:"Event" bson:"Event"`
+	Severity    string `json:"Severity" bson:"Severity"`
+	Server      struct {
+		Name    string `json:"Name" bson:"Name"`
+		ID      string `json:"Id" bson:"Id"`
+		Version string `json:"Version" bson:"Version"`
+	} `json:"Server" bson:"Server"`
+	User *struct {
+		Name string `json:"Name" bson:"Name"`
+		ID   string `json:"Id" bson:"Id"`
+	} `json:"User,omitempty" bson:"User,omitempty"`
+	Item *struct {
+		Name              string            `json:"Name" bson:"Name"`
+		ID                string            `json:"Id" bson:"Id"`
+		Type              string            `json:"Type" bson:"Type"`
+		MediaType         string            `json:"MediaType" bson:"MediaType"`
+		ProductionYear    int               `json:"ProductionYear" bson:"ProductionYear"`
+		RunTimeTicks      int64             `json:"RunTimeTicks" bson:"RunTimeTicks"`
+		SeriesName        string            `json:"SeriesName" bson:"SeriesName"`
+		ParentIndexNumber int               `json:"ParentIndexNumber" bson:"ParentIndexNumber"`
+		IndexNumber       int               `json:"IndexNumber" bson:"IndexNumber"`
+		Path              string            `json:"Path" bson:"Path"`
+		ProviderIDs       map[string]string `json:"ProviderIds" bson:"ProviderIds"`
+	} `json:"Item,omitempty" bson:"Item,omitempty"`
+	Session *struct {
+		ID                 string `json:"Id" bson:"Id"`
+		RemoteEndPoint     string `json:"RemoteEndPoint" bson:"RemoteEndPoint"`
+		Client             string `json:"Client" bson:"Client"`
+		DeviceName         string `json:"DeviceName" bson:"DeviceName"`
+		DeviceID           string `json:"DeviceId" bson:"DeviceId"`
+		ApplicationVersion string `json:"ApplicationVersion" bson:"ApplicationVersion"`
+	} `json:"Session,omitempty" bson:"Session,omitempty"`
+	PlaybackInfo *struct {
+		PositionTicks  int64  `json:"PositionTicks" bson:"PositionTicks"`
+		PlaySessionID  string `json:"PlaySessionId" bson:"PlaySessionId"`
+		PlaylistIndex  int    `json:"PlaylistIndex" bson:"PlaylistIndex"`
+		PlaylistLength int    `json:"PlaylistLength" bson:"PlaylistLength"`
+	} `json:"PlaybackInfo,omitempty" bson:"PlaybackInfo,omitempty"`
+	MediaServer MediaServerEvent `json:"mediaServer" bson:"mediaServer"`
+	ServiceName string           `json:"serviceName" bson:"serviceName"`
+	CreatedAt   time.Time        `json:"createdAt" bson:"createdAt"`
+}
+
+// ToJSON converts the EmbyWebhookData struct to a JSON string
+func (p *EmbyWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts a JSON string to a EmbyWebhookData struct
+func (p *EmbyWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts a HTTP request to a EmbyWebhookData struct
+func (p *EmbyWebhookData) FromHTTPRequest(r *http.Request) error {
+	// Emby sends the data in the "data" form field of a multipart request, like Plex does with "payload". Newer
+	// versions can be configured to send a plain JSON body instead.
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var err error
+	if mediaType == "multipart/form-data" {
+		err = json.Unmarshal([]byte(r.FormValue("data")), p)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(p)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.MediaServer = p.toMediaServerEvent()
+	p.ServiceName = "emby"
+	p.CreatedAt = time.Now()
+
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p EmbyWebhookData) Envelope() EventEnvelope {
+	envelope := mediaServerEnvelope(p.ServiceName, p.Event, p.MediaServer)
+	envelope.Instance = p.Server.Name
+	envelope.OccurredAt = parseEventTime(p.Date)
+	if envelope.Media != nil && p.Item != nil {
+		envelope.Media.Year = p.Item.ProductionYear
+	}
+	return envelope
+}
+
+// toMediaServerEvent returns the fields that are shared with the other media servers.
+func (p *EmbyWebhookData) toMediaServerEvent() MediaServerEvent {
+	event := MediaServerEvent{}
+	if p.User != nil {
+		event.User = p.User.Name
+	}
+	if p.Session != nil {
+		event.Player = p.Session.DeviceName
+	}
+	if p.Item != nil {
+		event.ItemTitle = p.Item.Name
+		event.ItemType = normalizeItemType(p.Item.Type)
+		event.SeriesTitle = p.Item.SeriesName
+		// Emby capitalizes the provider names (Tmdb, Tvdb, Imdb)
+		for provider, id := range p.Item.ProviderIDs {
+			switch strings.ToLower(provider) {
+			case "tmdb":
+				event.ProviderIDs.Tmdb = id
+			case "tvdb":
+				event.ProviderIDs.Tvdb = id
+			case "imdb":
+				event.ProviderIDs.Imdb = id
+			}
+		}
+	}
+	return event
+}
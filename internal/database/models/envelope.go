@@ -0,0 +1,346 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"plex_monitor/internal/database"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// EventCategoryPlayback is the category of media server events about something being played
+	EventCategoryPlayback = "playback"
+	// EventCategoryGrab is the category of events about a release being grabbed
+	EventCategoryGrab = "grab"
+	// EventCategoryDownload is the category of events about a download client finishing a download
+	EventCategoryDownload = "download"
+	// EventCategoryImport is the category of events about media being added to the library
+	EventCategoryImport = "import"
+	// EventCategoryHealth is the category of events about the health of a service
+	EventCategoryHealth = "health"
+	// EventCategoryRequest is the category of events about media requests
+	EventCategoryRequest = "request"
+	// EventCategoryIssue is the category of events about issues reported with media
+	EventCategoryIssue = "issue"
+	// EventCategoryOther is the category of the events that fit none of the others, like tests and renames
+	EventCategoryOther = "other"
+)
+
+// EventEnvelope is the document every webhook is stored as in the webhook collection. It holds the fields that are
+// normalized across all services, so events can be queried without knowing which service sent them, and the parsed
+// webhook data of the service nested under payload.
+type EventEnvelope struct {
+	ID primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	// Service is the type of the service that sent the event (sonarr, plex, qbittorrent, ...)
+	Service string `json:"service" bson:"service"`
+	// ServiceID is the ID of the configured service the webhook was authenticated with
+	ServiceID string `json:"serviceId,omitempty" bson:"serviceId,omitempty"`
+	// Instance is the name of the instance of the service, as reported by the service or configured for it
+	Instance string `json:"instance,omitempty" bson:"instance,omitempty"`
+	// Category is one of the EventCategory constants
+	Category string `json:"category" bson:"category"`
+	// Action is what happened, in lowercase snake case (play, grab, import, approved, ...)
+	Action string `json:"action" bson:"action"`
+	// EventType is the event type as sent by the service
+	EventType string `json:"eventType,omitempty" bson:"eventType,omitempty"`
+	// Media is the media the event is about, if any
+	Media *EventMedia `json:"media,omitempty" bson:"media,omitempty"`
+	// Actor is the user that caused the event, if the service reports one
+	Actor string `json:"actor,omitempty" bson:"actor,omitempty"`
+	// OccurredAt is when the event happened according to the service, or when it was received if the service doesn't
+	// say
+	OccurredAt time.Time `json:"occurredAt" bson:"occurredAt"`
+	// ReceivedAt is when the webhook was received
+	ReceivedAt time.Time `json:"receivedAt" bson:"receivedAt"`
+	// RawWireID is the ID of the raw request the event was parsed from, see StoreRawWire
+	RawWireID *primitive.ObjectID `json:"rawWireId,omitempty" bson:"rawWireId,omitempty"`
+	// Payload is the parsed webhook data of the service
+	Payload interface{} `json:"payload" bson:"payload"`
+}
+
+// EventMedia identifies the media an event is about.
+type EventMedia struct {
+	// Type is the lowercase type of the media (movie, series, episode, artist, album, author, book, ...)
+	Type        string `json:"type,omitempty" bson:"type,omitempty"`
+	Title       string `json:"title,omitempty" bson:"title,omitempty"`
+	SeriesTitle string `json:"seriesTitle,omitempty" bson:"seriesTitle,omitempty"`
+	Year        int    `json:"year,omitempty" bson:"year,omitempty"`
+	ProviderIDs `bson:",inline"`
+}
+
+// Event is implemented by the parsed webhook data of the services, which describe themselves with the normalized
+// fields of the envelope they are stored in.
+type Event interface {
+	// Envelope returns the envelope of the event, without the payload and the fields set when it is stored
+	Envelope() EventEnvelope
+}
+
+// NewEventEnvelope wraps the event in its envelope. Events that don't report when they occurred are assumed to have
+// occurred when they were received.
+func NewEventEnvelope(event Event, receivedAt time.Time) EventEnvelope {
+	envelope := event.Envelope()
+	if envelope.Category == "" {
+		envelope.Category = EventCategoryOther
+	}
+	if envelope.OccurredAt.IsZero() {
+		envelope.OccurredAt = receivedAt
+	}
+	envelope.ReceivedAt = receivedAt
+	envelope.Payload = event
+
+	return envelope
+}
+
+// LegacyEventFunc returns the event the service stored before events were stored in envelopes, or nil if it isn't
+// known.
+type LegacyEventFunc func(serviceName string, eventType string) Event
+
+// WrapLegacyEvent wraps an event that was stored before events were stored in envelopes. The typed payload is decoded
+// into the event newEvent returns for the serviceName of the document, and the documents of services it doesn't know
+// are kept as they are.
+func WrapLegacyEvent(doc bson.Raw, newEvent LegacyEventFunc) (EventEnvelope, error) {
+	var legacy struct {
+		ID          primitive.ObjectID  `bson:"_id"`
+		ServiceName string              `bson:"serviceName"`
+		EventType   string              `bson:"eventType"`
+		RawWireID   *primitive.ObjectID `bson:"rawWireId"`
+		CreatedAt   time.Time           `bson:"createdAt"`
+	}
+	err := bson.Unmarshal(doc, &legacy)
+	if err != nil {
+		return EventEnvelope{}, err
+	}
+	// Documents without a creation time were created when their ID was
+	if legacy.CreatedAt.IsZero() {
+		legacy.CreatedAt = legacy.ID.Timestamp()
+	}
+
+	var envelope EventEnvelope
+	if event := newEvent(legacy.ServiceName, legacy.EventType); event != nil {
+		err = bson.Unmarshal(doc, event)
+		if err != nil {
+			return EventEnvelope{}, err
+		}
+		envelope = NewEventEnvelope(event, legacy.CreatedAt)
+	} else {
+		fields := bson.D{}
+		err = bson.Unmarshal(doc, &fields)
+		if err != nil {
+			return EventEnvelope{}, err
+		}
+		payload := bson.D{}
+		for _, field := range fields {
+			if field.Key != "_id" && field.Key != "rawWireId" {
+				payload = append(payload, field)
+			}
+		}
+		envelope = EventEnvelope{
+			Service:    legacy.ServiceName,
+			Category:   EventCategoryOther,
+			Action:     normalizeAction(legacy.EventType),
+			EventType:  legacy.EventType,
+			OccurredAt: legacy.CreatedAt,
+			ReceivedAt: legacy.CreatedAt,
+			Payload:    payload,
+		}
+	}
+
+	envelope.ID = legacy.ID
+	envelope.RawWireID = legacy.RawWireID
+	return envelope, nil
+}
+
+// MigrateLegacyEvents wraps the events that were stored before events were stored in envelopes, see WrapLegacyEvent.
+// Events that can't be wrapped are skipped and reported in the returned error, along with the number of events that
+// were wrapped.
+func MigrateLegacyEvents(newEvent LegacyEventFunc) (int, error) {
+	collection := database.DB.Collection(database.WebhookCollectionName)
+
+	cursor, err := collection.Find(context.Background(), bson.M{"payload": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	wrapped := 0
+	errs := []error{}
+	for cursor.Next(context.Background()) {
+		envelope, err := WrapLegacyEvent(cursor.Current, newEvent)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not wrap event: %w", err))
+			continue
+		}
+
+		_, err = collection.ReplaceOne(context.Background(), bson.M{"_id": envelope.ID}, envelope)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not replace event %s: %w", envelope.ID.Hex(), err))
+			continue
+		}
+		wrapped++
+	}
+	errs = append(errs, cursor.Err())
+
+	return wrapped, errors.Join(errs...)
+}
+
+// eventAction is the normalized category and action of an event type.
+type eventAction struct {
+	category string
+	action   string
+}
+
+// mediaServerEventActions maps the lowercase event types of the media servers onto their category and action.
+var mediaServerEventActions = map[string]eventAction{
+	// Plex
+	"media.play":     {EventCategoryPlayback, "play"},
+	"media.pause":    {EventCategoryPlayback, "pause"},
+	"media.resume":   {EventCategoryPlayback, "resume"},
+	"media.stop":     {EventCategoryPlayback, "stop"},
+	"media.scrobble": {EventCategoryPlayback, "scrobble"},
+	"media.rate":     {EventCategoryPlayback, "rate"},
+	"library.new":    {EventCategoryImport, "added"},
+	// Emby
+	"playback.start":   {EventCategoryPlayback, "play"},
+	"playback.pause":   {EventCategoryPlayback, "pause"},
+	"playback.unpause": {EventCategoryPlayback, "resume"},
+	"playback.stop":    {EventCategoryPlayback, "stop"},
+	"item.markplayed":  {EventCategoryPlayback, "scrobble"},
+	"item.rate":        {EventCategoryPlayback, "rate"},
+	// Jellyfin
+	"playbackstart":    {EventCategoryPlayback, "play"},
+	"playbackprogress": {EventCategoryPlayback, "progress"},
+	"playbackstop":     {EventCategoryPlayback, "stop"},
+	"itemadded":        {EventCategoryImport, "added"},
+	// Tautulli
+	"play":    {EventCategoryPlayback, "play"},
+	"pause":   {EventCategoryPlayback, "pause"},
+	"resume":  {EventCategoryPlayback, "resume"},
+	"stop":    {EventCategoryPlayback, "stop"},
+	"buffer":  {EventCategoryPlayback, "buffer"},
+	"watched": {EventCategoryPlayback, "scrobble"},
+	"created": {EventCategoryImport, "added"},
+}
+
+// requestEventActions maps the Ombi notification types, which the Overseerr ones are mapped onto, onto their category
+// and action.
+var requestEventActions = map[string]eventAction{
+	"NewRequest":            {EventCategoryRequest, "requested"},
+	"RequestApproved":       {EventCategoryRequest, "approved"},
+	"RequestAvailable":      {EventCategoryRequest, "available"},
+	"RequestDeclined":       {EventCategoryRequest, "declined"},
+	"ItemAddedToFaultQueue": {EventCategoryRequest, "failed"},
+	"Issue":                 {EventCategoryIssue, "created"},
+	"IssueComment":          {EventCategoryIssue, "commented"},
+	"IssueResolved":         {EventCategoryIssue, "resolved"},
+	"Test":                  {EventCategoryOther, "test"},
+}
+
+// mediaServerEnvelope returns the envelope of a media server event from the fields shared by the media servers.
+func mediaServerEnvelope(service string, eventType string, event MediaServerEvent) EventEnvelope {
+	envelope := EventEnvelope{
+		Service:   service,
+		Category:  EventCategoryOther,
+		Action:    normalizeAction(eventType),
+		EventType: eventType,
+		Actor:     event.User,
+	}
+	if a, ok := mediaServerEventActions[strings.ToLower(eventType)]; ok {
+		envelope.Category, envelope.Action = a.category, a.action
+	}
+	if event.ItemTitle != "" || event.ProviderIDs != (ProviderIDs{}) {
+		envelope.Media = &EventMedia{
+			Type:        event.ItemType,
+			Title:       event.ItemTitle,
+			SeriesTitle: event.SeriesTitle,
+			ProviderIDs: event.ProviderIDs,
+		}
+	}
+	return envelope
+}
+
+// servarrEnvelope returns the envelope of a Servarr application event from its event type.
+func servarrEnvelope(service string, eventType string, instance string, isUpgrade *bool) EventEnvelope {
+	envelope := EventEnvelope{
+		Service:   service,
+		Instance:  instance,
+		Category:  EventCategoryOther,
+		Action:    normalizeAction(eventType),
+		EventType: eventType,
+	}
+
+	switch eventType {
+	case "Grab":
+		envelope.Category, envelope.Action = EventCategoryGrab, "grab"
+	case "Download", "AlbumDownload", "BookFileImport":
+		envelope.Category, envelope.Action = EventCategoryImport, "import"
+		if isUpgrade != nil && *isUpgrade {
+			envelope.Action = "upgrade"
+		}
+	case ServarrHealthEvent, ServarrHealthRestoredEvent:
+		envelope.Category = EventCategoryHealth
+	}
+	return envelope
+}
+
+// requestEnvelope returns the envelope of a request frontend event from its Ombi notification type.
+func requestEnvelope(service string, notificationType string) EventEnvelope {
+	envelope := EventEnvelope{
+		Service:   service,
+		Category:  EventCategoryOther,
+		Action:    normalizeAction(notificationType),
+		EventType: notificationType,
+	}
+	if a, ok := requestEventActions[notificationType]; ok {
+		envelope.Category, envelope.Action = a.category, a.action
+	}
+	return envelope
+}
+
+// normalizeAction converts an event type to lowercase snake case, e.g. MovieFileDelete becomes movie_file_delete and
+// admin.database.backup becomes admin_database_backup.
+func normalizeAction(eventType string) string {
+	var b strings.Builder
+	var prev rune
+	for _, r := range eventType {
+		switch {
+		case unicode.IsUpper(r):
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			if b.Len() > 0 && prev != '_' {
+				b.WriteByte('_')
+			}
+			r = '_'
+		}
+		prev = r
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+// providerID formats a numeric provider ID, leaving it empty when it isn't known.
+func providerID(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+// parseEventTime parses the RFC 3339 time an event occurred at, returning the zero time if it can't be parsed.
+func parseEventTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"bytes"
+	"compress/gzip"
+	"fmt"
 	"io"
 	"plex_monitor/internal/database"
 
@@ -14,6 +16,12 @@ import (
 const (
 	// RawRequestWiresBucket is the name of the GridFS bucket for storing raw request wires.
 	RawRequestWiresBucket = "raw_request_wires"
+	// UnredactedRawWiresBucket is the name of the GridFS bucket for storing the encrypted raw request wires as they were
+	// received, before secrets were redacted from them.
+	UnredactedRawWiresBucket = "raw_request_wires_unredacted"
+
+	// gzipCompression is the compression stored in the metadata of gzip-compressed files.
+	gzipCompression = "gzip"
 )
 
 // createBucket creates a new GridFS bucket for storing raw request wires.
@@ -27,28 +35,66 @@ func createBucket(bucketName string) (*gridfs.Bucket, error) {
 	return bucket, nil
 }
 
-// AddFileToBucket adds a file to the GridFS bucket.
+// AddFileToBucket adds a file to the GridFS bucket. The file is stored gzip-compressed when that makes it smaller,
+// which GetFileFromBucket undoes.
 func AddFileToBucket(bucketName string, filename string, file []byte, metadata bson.M) (*primitive.ObjectID, error) {
+	objectID := primitive.NewObjectID()
+	err := AddFileToBucketWithID(bucketName, objectID, filename, file, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectID, nil
+}
+
+// AddFileToBucketWithID adds a file with the supplied ID to the GridFS bucket, compressed like AddFileToBucket.
+func AddFileToBucketWithID(bucketName string, id primitive.ObjectID, filename string, file []byte, metadata bson.M) error {
 	// Create a new bucket or get the existing one
 	bucket, err := createBucket(bucketName)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Add metadata to the file
-	uploadOpts := options.GridFSUpload().SetMetadata(metadata)
+	stored, compression, err := compressFile(file)
+	if err != nil {
+		return err
+	}
+
+	// Add metadata to the file, including how it was compressed
+	fileMetadata := bson.M{}
+	for k, v := range metadata {
+		fileMetadata[k] = v
+	}
+	if compression != "" {
+		fileMetadata["compression"] = compression
+	}
+	fileMetadata["uncompressedSize"] = len(file)
+	uploadOpts := options.GridFSUpload().SetMetadata(fileMetadata)
 
 	// Upload the file to the bucket
-	objectID, err := bucket.UploadFromStream(filename, io.NopCloser(bytes.NewReader(file)), uploadOpts)
+	return bucket.UploadFromStreamWithID(id, filename, io.NopCloser(bytes.NewReader(stored)), uploadOpts)
+}
+
+// GetFileFromBucket gets a file from the GridFS bucket by filename.
+func GetFileFromBucket(bucketName string, filename string) ([]byte, error) {
+	// Create a new bucket or get the existing one
+	bucket, err := createBucket(bucketName)
 	if err != nil {
 		return nil, err
 	}
 
-	return &objectID, nil
+	// Get a file from the bucket
+	stream, err := bucket.OpenDownloadStreamByName(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	return readFile(stream)
 }
 
-// GetFileFromBucket gets a file from the GridFS bucket by filename.
-func GetFileFromBucket(bucketName string, filename string) ([]byte, error) {
+// GetFileFromBucketByID gets a file from the GridFS bucket by ID.
+func GetFileFromBucketByID(bucketName string, id primitive.ObjectID) ([]byte, error) {
 	// Create a new bucket or get the existing one
 	bucket, err := createBucket(bucketName)
 	if err != nil {
@@ -56,13 +102,24 @@ func GetFileFromBucket(bucketName string, filename string) ([]byte, error) {
 	}
 
 	// Get a file from the bucket
-	var buf bytes.Buffer
-	_, err = bucket.DownloadToStreamByName(filename, &buf)
+	stream, err := bucket.OpenDownloadStream(id)
 	if err != nil {
 		return nil, err
 	}
+	defer stream.Close()
 
-	return buf.Bytes(), nil
+	return readFile(stream)
+}
+
+// DeleteFileFromBucket deletes a file and its chunks from the GridFS bucket.
+func DeleteFileFromBucket(bucketName string, id interface{}) error {
+	// Create a new bucket or get the existing one
+	bucket, err := createBucket(bucketName)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Delete(id)
 }
 
 // ListFilesInBucket lists all files in the GridFS bucket.
@@ -110,3 +167,75 @@ func CountFilesInBucket(bucketName string, query bson.M) (int64, error) {
 
 	return count, nil
 }
+
+// readFile reads the file from the download stream, decompressing it if it was stored compressed.
+func readFile(stream *gridfs.DownloadStream) ([]byte, error) {
+	file, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata struct {
+		Compression string `bson:"compression"`
+	}
+	if raw := stream.GetFile().Metadata; len(raw) > 0 {
+		err = bson.Unmarshal(raw, &metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return decompressFile(file, metadata.Compression)
+}
+
+// gzipFile returns the gzip-compressed file.
+func gzipFile(file []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(file)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not compress file: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// compressFile gzips the file, or returns it as is if that doesn't make it smaller. The compression that was used is
+// returned along with the data to store, and is empty if the file is stored uncompressed.
+func compressFile(file []byte) ([]byte, string, error) {
+	compressed, err := gzipFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(compressed) >= len(file) {
+		return file, "", nil
+	}
+	return compressed, gzipCompression, nil
+}
+
+// decompressFile undoes compressFile. Files stored before compression was added have no compression and are returned
+// as is.
+func decompressFile(file []byte, compression string) ([]byte, error) {
+	switch compression {
+	case "":
+		return file, nil
+	case gzipCompression:
+		reader, err := gzip.NewReader(bytes.NewReader(file))
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress file: %w", err)
+		}
+		defer reader.Close()
+
+		decompressed, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("could not decompress file: %w", err)
+		}
+		return decompressed, nil
+	default:
+		return nil, fmt.Errorf("unknown file compression %q", compression)
+	}
+}
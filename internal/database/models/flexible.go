@@ -0,0 +1,46 @@
+package models
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// FlexibleInt is an integer that can be decoded from either a JSON number or a JSON string. Templated payloads, such
+// as the ones sent by Tautulli, quote every value and leave it empty when it isn't available.
+type FlexibleInt int64
+
+// UnmarshalJSON decodes the integer from a JSON number or a (possibly empty) JSON string.
+func (i *FlexibleInt) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	if len(data) == 0 || string(data) == "null" {
+		*i = 0
+		return nil
+	}
+
+	n, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return err
+	}
+	*i = FlexibleInt(n)
+	return nil
+}
+
+// FlexibleBool is a boolean that can be decoded from either a JSON boolean or a JSON string, for the same templated
+// payloads as FlexibleInt.
+type FlexibleBool bool
+
+// UnmarshalJSON decodes the boolean from a JSON boolean or a (possibly empty) JSON string.
+func (b *FlexibleBool) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	if len(data) == 0 || string(data) == "null" {
+		*b = false
+		return nil
+	}
+
+	value, err := strconv.ParseBool(string(data))
+	if err != nil {
+		return err
+	}
+	*b = FlexibleBool(value)
+	return nil
+}
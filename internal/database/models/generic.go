@@ -0,0 +1,178 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// GenericMappingEventType is the mapping key of the path to the event type
+	GenericMappingEventType = "eventType"
+	// GenericMappingTitle is the mapping key of the path to the title
+	GenericMappingTitle = "title"
+	// GenericMappingUser is the mapping key of the path to the user
+	GenericMappingUser = "user"
+	// GenericMappingSeverity is the mapping key of the path to the severity
+	GenericMappingSeverity = "severity"
+	// GenericMappingTimestamp is the mapping key of the path to the timestamp
+	GenericMappingTimestamp = "timestamp"
+)
+
+// GenericWebhookData is the struct that represents any JSON object posted to the generic service. The normalized
+// fields are extracted from the payload using the field mappings of the service config, which map each field to a
+// dotted path (or a simple JSONPath such as "$.data.items[0].name") in the payload.
+type GenericWebhookData struct {
+	EventType   string                 `json:"eventType" bson:"eventType"`
+	Title       string                 `json:"title" bson:"title"`
+	User        string                 `json:"user" bson:"user"`
+	Severity    string                 `json:"severity" bson:"severity"`
+	Timestamp   *time.Time             `json:"timestamp,omitempty" bson:"timestamp,omitempty"`
+	Payload     map[string]interface{} `json:"payload" bson:"payload"`
+	ServiceID   string                 `json:"serviceId" bson:"serviceId"`
+	Source      string                 `json:"source" bson:"source"`
+	ServiceName string                 `json:"serviceName" bson:"serviceName"`
+	CreatedAt   time.Time              `json:"createdAt" bson:"createdAt"`
+}
+
+// ToJSON converts the struct to JSON
+func (p *GenericWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct
+func (p *GenericWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts the HTTP request to struct. The body must be a JSON object.
+func (p *GenericWebhookData) FromHTTPRequest(r *http.Request) error {
+	p.Payload = map[string]interface{}{}
+	err := json.NewDecoder(r.Body).Decode(&p.Payload)
+	if err != nil {
+		return err
+	}
+	p.ServiceName = "generic"
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event from its mapped fields, see EventEnvelope. The event types of
+// generic webhooks aren't known, so they are always categorized as other.
+func (p GenericWebhookData) Envelope() EventEnvelope {
+	envelope := EventEnvelope{
+		Service:   p.ServiceName,
+		Category:  EventCategoryOther,
+		Action:    normalizeAction(p.EventType),
+		EventType: p.EventType,
+		Actor:     p.User,
+	}
+	if p.Timestamp != nil {
+		envelope.OccurredAt = *p.Timestamp
+	}
+	return envelope
+}
+
+// ApplyMappings fills in the normalized fields from the payload using the supplied mappings of field to path. Paths
+// that don't exist in the payload leave the field empty.
+func (p *GenericWebhookData) ApplyMappings(mappings map[string]string) error {
+	p.EventType = lookupString(p.Payload, mappings[GenericMappingEventType])
+	p.Title = lookupString(p.Payload, mappings[GenericMappingTitle])
+	p.User = lookupString(p.Payload, mappings[GenericMappingUser])
+	p.Severity = lookupString(p.Payload, mappings[GenericMappingSeverity])
+
+	if path := mappings[GenericMappingTimestamp]; path != "" {
+		if value, ok := LookupPath(p.Payload, path); ok && value != nil {
+			timestamp, err := parseTimestamp(value)
+			if err != nil {
+				return fmt.Errorf("invalid timestamp at %s: %w", path, err)
+			}
+			p.Timestamp = &timestamp
+		}
+	}
+	return nil
+}
+
+// LookupPath returns the value at the dotted path in the decoded JSON value. Array elements are addressed by index,
+// either as a path segment ("items.0.name") or in brackets ("items[0].name"), and a leading "$." is ignored.
+func LookupPath(data interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, false
+	}
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	current := data
+	for _, segment := range strings.Split(path, ".") {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			next, ok := value[segment]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			current = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// lookupString returns the value at the path as a string, or an empty string if there is no such value.
+func lookupString(data interface{}, path string) string {
+	value, ok := LookupPath(data, path)
+	if !ok || value == nil {
+		return ""
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseTimestamp parses an RFC 3339 timestamp, or a unix timestamp in seconds or milliseconds.
+func parseTimestamp(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unsupported format: %s", v)
+		}
+		return unixTimestamp(n), nil
+	case float64:
+		return unixTimestamp(v), nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported type: %T", value)
+	}
+}
+
+// unixTimestamp converts a unix timestamp to a time, treating values that are too large to be seconds as milliseconds.
+func unixTimestamp(n float64) time.Time {
+	if n > 1e12 {
+		return time.UnixMilli(int64(n))
+	}
+	seconds, fraction := math.Modf(n)
+	return time.Unix(int64(seconds), int64(fraction*1e9))
+}
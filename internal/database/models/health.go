@@ -0,0 +1,235 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"plex_monitor/internal/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// ServarrHealthEvent is the event type of a health check that started failing
+	ServarrHealthEvent = "Health"
+	// ServarrHealthRestoredEvent is the event type of a health check that passes again
+	ServarrHealthRestoredEvent = "HealthRestored"
+)
+
+// HealthIssue is a failing health check of a Servarr application, from the Health event that opened it to the
+// HealthRestored event that closed it. There is at most one open issue per service, instance, type and message.
+type HealthIssue struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ServiceName string             `json:"serviceName" bson:"serviceName"`
+	ServiceID   string             `json:"serviceId,omitempty" bson:"serviceId,omitempty"`
+	Instance    string             `json:"instance" bson:"instance"`
+	Type        string             `json:"type" bson:"type"`
+	Message     string             `json:"message" bson:"message"`
+	Level       string             `json:"level" bson:"level"`
+	WikiURL     string             `json:"wikiUrl,omitempty" bson:"wikiUrl,omitempty"`
+	Open        bool               `json:"open" bson:"open"`
+	// Occurrences is the number of Health events that were received while the issue was open
+	Occurrences int64               `json:"occurrences" bson:"occurrences"`
+	OpenedAt    time.Time           `json:"openedAt" bson:"openedAt"`
+	LastSeenAt  time.Time           `json:"lastSeenAt" bson:"lastSeenAt"`
+	ClosedAt    *time.Time          `json:"closedAt,omitempty" bson:"closedAt,omitempty"`
+	OpenedBy    *primitive.ObjectID `json:"openedBy,omitempty" bson:"openedBy,omitempty"`
+	ClosedBy    *primitive.ObjectID `json:"closedBy,omitempty" bson:"closedBy,omitempty"`
+	// DurationSeconds is how long the issue was open, up to now for open issues (see WithDuration)
+	DurationSeconds int64 `json:"durationSeconds" bson:"durationSeconds"`
+}
+
+// WithDuration returns the issue with the duration of open issues computed up to the supplied time. The duration of
+// closed issues is stored when they are closed.
+func (i HealthIssue) WithDuration(now time.Time) HealthIssue {
+	if i.Open {
+		i.DurationSeconds = int64(now.Sub(i.OpenedAt).Seconds())
+	}
+	return i
+}
+
+// healthRestore is the last time a health check of a service passed again, which is kept so Health events that are
+// processed after the HealthRestored event that resolved them don't open an issue that never closes.
+type healthRestore struct {
+	ServiceName string              `bson:"serviceName"`
+	Instance    string              `bson:"instance"`
+	Type        string              `bson:"type"`
+	RestoredAt  time.Time           `bson:"restoredAt"`
+	RestoredBy  *primitive.ObjectID `bson:"restoredBy,omitempty"`
+}
+
+// TrackHealthIssue opens or closes the health issue of the Servarr health event, depending on its event type. The
+// eventID is the ID of the stored event, at is when it was received, and the serviceID and instance identify the
+// service it was received for. Events may be processed out of order (see webhook.StartSpool): a Health event received
+// before the last HealthRestored event of its check is recorded as an issue that was closed by that restore.
+func TrackHealthIssue(health ServarrHealthData, serviceID string, instance string, eventID *primitive.ObjectID, at time.Time) error {
+	switch health.EventType {
+	case ServarrHealthEvent:
+		return openHealthIssue(health, serviceID, instance, eventID, at)
+	case ServarrHealthRestoredEvent:
+		return closeHealthIssue(health, instance, eventID, at)
+	}
+	return nil
+}
+
+// openHealthIssue opens the issue of the failing health check, or records that it is still failing if it is open.
+func openHealthIssue(health ServarrHealthData, serviceID string, instance string, eventID *primitive.ObjectID, at time.Time) error {
+	filter := bson.M{
+		"serviceName": health.ServiceName,
+		"instance":    instance,
+		"type":        health.Type,
+		"message":     health.Message,
+		"open":        true,
+	}
+	update := bson.M{
+		"$setOnInsert": bson.M{"openedAt": at, "openedBy": eventID, "serviceId": serviceID},
+		"$set":         bson.M{"level": health.Level, "wikiUrl": health.WikiURL},
+		"$max":         bson.M{"lastSeenAt": at},
+		"$inc":         bson.M{"occurrences": 1},
+	}
+	collection := database.DB.Collection(database.HealthIssuesCollectionName)
+	_, err := collection.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	// Concurrent upserts of the same issue can both insert, one of which fails on the unique index. The retry finds the
+	// issue the other one inserted and updates it.
+	if mongo.IsDuplicateKeyError(err) {
+		_, err = collection.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	}
+	if err != nil {
+		return fmt.Errorf("could not open health issue: %w", err)
+	}
+
+	// The check may already have passed again after this event, in which case the restore closes the issue. This is
+	// checked after the issue is opened, since the restore records itself before it closes the open issues.
+	restore, err := getHealthRestore(health.ServiceName, instance, health.Type)
+	if err != nil {
+		return fmt.Errorf("could not open health issue: %w", err)
+	}
+	if restore == nil || restore.RestoredAt.Before(at) {
+		return nil
+	}
+
+	filter["openedAt"] = bson.M{"$lte": restore.RestoredAt}
+	err = closeHealthIssues(filter, restore.RestoredBy, restore.RestoredAt)
+	if err != nil {
+		return fmt.Errorf("could not open health issue: %w", err)
+	}
+	return nil
+}
+
+// closeHealthIssue records that the health check passes again and closes its open issue. The message of a check can
+// change while it fails, e.g. when more indexers fail, so when no issue with the same message is open, the open issue
+// of the same type is closed. That is only done when exactly one issue of the type is open, since the restore can't
+// tell which of several issues it resolves, e.g. when different indexers fail.
+func closeHealthIssue(health ServarrHealthData, instance string, eventID *primitive.ObjectID, at time.Time) error {
+	err := recordHealthRestore(health, instance, eventID, at)
+	if err != nil {
+		return fmt.Errorf("could not close health issue: %w", err)
+	}
+
+	// Issues opened after the restore was received are failing again
+	filter := bson.M{
+		"serviceName": health.ServiceName,
+		"instance":    instance,
+		"type":        health.Type,
+		"message":     health.Message,
+		"open":        true,
+		"openedAt":    bson.M{"$lte": at},
+	}
+	count, err := database.DB.Collection(database.HealthIssuesCollectionName).CountDocuments(context.Background(), filter)
+	if err == nil && count == 0 {
+		delete(filter, "message")
+		count, err = database.DB.Collection(database.HealthIssuesCollectionName).CountDocuments(context.Background(), filter)
+		if err == nil && count != 1 {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("could not close health issue: %w", err)
+	}
+
+	err = closeHealthIssues(filter, eventID, at)
+	if err != nil {
+		return fmt.Errorf("could not close health issue: %w", err)
+	}
+	return nil
+}
+
+// closeHealthIssues closes the open issues matching the filter, with their duration up to the supplied time.
+func closeHealthIssues(filter bson.M, eventID *primitive.ObjectID, at time.Time) error {
+	issues, err := GetHealthIssues(filter, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range issues {
+		update := bson.M{"$set": bson.M{
+			"open":            false,
+			"closedAt":        at,
+			"closedBy":        eventID,
+			"durationSeconds": int64(at.Sub(issue.OpenedAt).Seconds()),
+		}}
+		_, err = database.DB.Collection(database.HealthIssuesCollectionName).UpdateOne(context.Background(), bson.M{"_id": issue.ID, "open": true}, update)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordHealthRestore records when the health check passed again, unless a later restore was already recorded.
+func recordHealthRestore(health ServarrHealthData, instance string, eventID *primitive.ObjectID, at time.Time) error {
+	filter := bson.M{
+		"serviceName": health.ServiceName,
+		"instance":    instance,
+		"type":        health.Type,
+		"restoredAt":  bson.M{"$lt": at},
+	}
+	update := bson.M{"$set": bson.M{"restoredAt": at, "restoredBy": eventID}}
+	_, err := database.DB.Collection(database.HealthRestoresCollectionName).UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	// A later restore matches the key but not the time, so the upsert runs into it
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+// getHealthRestore returns the last restore of the health check, or nil if it never passed again.
+func getHealthRestore(serviceName string, instance string, checkType string) (*healthRestore, error) {
+	restore := healthRestore{}
+	err := database.DB.Collection(database.HealthRestoresCollectionName).FindOne(context.Background(), bson.M{
+		"serviceName": serviceName,
+		"instance":    instance,
+		"type":        checkType,
+	}).Decode(&restore)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &restore, nil
+}
+
+// GetHealthIssues returns the health issues matching the filter, most recently opened first. A limit of 0 returns
+// all of them.
+func GetHealthIssues(filter bson.M, limit int64) ([]HealthIssue, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "openedAt", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := database.DB.Collection(database.HealthIssuesCollectionName).Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := []HealthIssue{}
+	err = cursor.All(context.Background(), &issues)
+	if err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// JellyfinWebhookData is the struct that represents the data sent by the Jellyfin Webhook plugin. The plugin should be
+// configured with a Generic destination that has "Send All Properties" enabled.
+type JellyfinWebhookData struct {
+	NotificationType      string           `json:"NotificationType" bson:"NotificationType"`
+	ServerID              string           `json:"ServerId" bson:"ServerId"`
+	ServerName            string           `json:"ServerName" bson:"ServerName"`
+	ServerVersion         string           `json:"ServerVersion" bson:"ServerVersion"`
+	ServerURL             string           `json:"ServerUrl" bson:"ServerUrl"`
+	Timestamp             string           `json:"Timestamp" bson:"Timestamp"`
+	UtcTimestamp          string           `json:"UtcTimestamp" bson:"UtcTimestamp"`
+	Name                  string           `json:"Name" bson:"Name"`
+	Overview              string           `json:"Overview" bson:"Overview"`
+	ItemID                string           `json:"ItemId" bson:"ItemId"`
+	ItemType              string           `json:"ItemType" bson:"ItemType"`
+	Year                  int              `json:"Year" bson:"Year"`
+	SeriesName            string           `json:"SeriesName" bson:"SeriesName"`
+	SeasonNumber          int              `json:"SeasonNumber" bson:"SeasonNumber"`
+	EpisodeNumber         int              `json:"EpisodeNumber" bson:"EpisodeNumber"`
+	RunTimeTicks          int64            `json:"RunTimeTicks" bson:"RunTimeTicks"`
+	ProviderTmdb          string           `json:"Provider_tmdb" bson:"Provider_tmdb"`
+	ProviderTvdb          string           `json:"Provider_tvdb" bson:"Provider_tvdb"`
+	ProviderImdb          string           `json:"Provider_imdb" bson:"Provider_imdb"`
+	PlaybackPositionTicks int64            `json:"PlaybackPositionTicks" bson:"PlaybackPositionTicks"`
+	IsPaused              bool             `json:"IsPaused" bson:"IsPaused"`
+	PlayedToCompletion    bool             `json:"PlayedToCompletion" bson:"PlayedToCompletion"`
+	DeviceID              string           `json:"DeviceId" bson:"DeviceId"`
+	DeviceName            string           `json:"DeviceName" bson:"DeviceName"`
+	ClientName            string           `json:"ClientName" bson:"ClientName"`
+	NotificationUsername  string           `json:"NotificationUsername" bson:"NotificationUsername"`
+	UserID                string           `json:"UserId" bson:"UserId"`
+	Username              string           `json:"Username" bson:"Username"`
+	RemoteEndPoint        string           `json:"RemoteEndPoint" bson:"RemoteEndPoint"`
+	MediaServer           MediaServerEvent `json:"mediaServer" bson:"mediaServer"`
+	ServiceName           string           `json:"serviceName" bson:"serviceName"`
+	CreatedAt             time.Time        `json:"createdAt" bson:"createdAt"`
+}
+
+// ToJSON converts the JellyfinWebhookData struct to a JSON string
+func (p *JellyfinWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts a JSON string to a JellyfinWebhookData struct
+func (p *JellyfinWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts a HTTP request to a JellyfinWebhookData struct
+func (p *JellyfinWebhookData) FromHTTPRequest(r *http.Request) error {
+	err := json.NewDecoder(r.Body).Decode(p)
+	if err != nil {
+		return err
+	}
+
+	p.MediaServer = p.toMediaServerEvent()
+	p.ServiceName = "jellyfin"
+	p.CreatedAt = time.Now()
+
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p JellyfinWebhookData) Envelope() EventEnvelope {
+	envelope := mediaServerEnvelope(p.ServiceName, p.NotificationType, p.MediaServer)
+	envelope.Instance = p.ServerName
+	envelope.OccurredAt = parseEventTime(p.UtcTimestamp)
+	if envelope.Media != nil {
+		envelope.Media.Year = p.Year
+	}
+	return envelope
+}
+
+// toMediaServerEvent returns the fields that are shared with the other media servers.
+func (p *JellyfinWebhookData) toMediaServerEvent() MediaServerEvent {
+	user := p.NotificationUsername
+	// Authentication failures only carry the username that was attempted
+	if user == "" {
+		user = p.Username
+	}
+
+	return MediaServerEvent{
+		User:        user,
+		Player:      p.DeviceName,
+		ItemTitle:   p.Name,
+		ItemType:    normalizeItemType(p.ItemType),
+		SeriesTitle: p.SeriesName,
+		ProviderIDs: ProviderIDs{
+			Tmdb: p.ProviderTmdb,
+			Tvdb: p.ProviderTvdb,
+			Imdb: p.ProviderImdb,
+		},
+	}
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LidarrWebhookData is the struct that represents the data that is sent from Lidarr.
+type LidarrWebhookData struct {
+	Artist             *LidarrArtist            `json:"artist,omitempty" bson:"artist,omitempty"`
+	Album              *LidarrAlbum             `json:"album,omitempty" bson:"album,omitempty"`
+	Albums             []LidarrAlbum            `json:"albums,omitempty" bson:"albums,omitempty"`
+	Tracks             []LidarrTrack            `json:"tracks,omitempty" bson:"tracks,omitempty"`
+	TrackFile          *LidarrTrackFile         `json:"trackFile,omitempty" bson:"trackFile,omitempty"`
+	TrackFiles         []LidarrTrackFile        `json:"trackFiles,omitempty" bson:"trackFiles,omitempty"`
+	RenamedTrackFiles  []LidarrRenamedTrackFile `json:"renamedTrackFiles,omitempty" bson:"renamedTrackFiles,omitempty"`
+	Release            *LidarrRelease           `json:"release,omitempty" bson:"release,omitempty"`
+	IsUpgrade          *bool                    `json:"isUpgrade,omitempty" bson:"isUpgrade,omitempty"`
+	DownloadClient     *string                  `json:"downloadClient,omitempty" bson:"downloadClient,omitempty"`
+	DownloadClientType *string                  `json:"downloadClientType,omitempty" bson:"downloadClientType,omitempty"`
+	DownloadID         *string                  `json:"downloadId,omitempty" bson:"downloadId,omitempty"`
+	// DeletedFiles is a list of track files on imports, but a boolean on ArtistDelete and AlbumDelete events.
+	DeletedFiles   interface{}         `json:"deletedFiles,omitempty" bson:"deletedFiles,omitempty"`
+	ProwlarrGrabID *primitive.ObjectID `json:"prowlarrGrabId,omitempty" bson:"prowlarrGrabId,omitempty"`
+	EventType      string              `json:"eventType" bson:"eventType"`
+	InstanceName   string              `json:"instanceName" bson:"instanceName"`
+	ApplicationURL string              `json:"applicationUrl" bson:"applicationUrl"`
+	ServiceName    string              `json:"serviceName" bson:"serviceName"`
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// LidarrArtist is the struct that represents the artist data that is sent from Lidarr.
+type LidarrArtist struct {
+	ID             int      `json:"id" bson:"id"`
+	Name           string   `json:"name" bson:"name"`
+	Disambiguation string   `json:"disambiguation" bson:"disambiguation"`
+	Path           string   `json:"path" bson:"path"`
+	MbID           string   `json:"mbId" bson:"mbId"`
+	Type           string   `json:"type" bson:"type"`
+	Overview       string   `json:"overview" bson:"overview"`
+	Genres         []string `json:"genres" bson:"genres"`
+	Tags           []string `json:"tags" bson:"tags"`
+}
+
+// LidarrAlbum is the struct that represents the album data that is sent from Lidarr.
+type LidarrAlbum struct {
+	ID                  int      `json:"id" bson:"id"`
+	MbID                string   `json:"mbId" bson:"mbId"`
+	Title               string   `json:"title" bson:"title"`
+	Disambiguation      string   `json:"disambiguation" bson:"disambiguation"`
+	Overview            string   `json:"overview" bson:"overview"`
+	AlbumType           string   `json:"albumType" bson:"albumType"`
+	SecondaryAlbumTypes []string `json:"secondaryAlbumTypes" bson:"secondaryAlbumTypes"`
+	ReleaseDate         string   `json:"releaseDate" bson:"releaseDate"`
+	Genres              []string `json:"genres" bson:"genres"`
+}
+
+// LidarrTrack is the struct that represents the track data that is sent from Lidarr.
+type LidarrTrack struct {
+	ID             int    `json:"id" bson:"id"`
+	Title          string `json:"title" bson:"title"`
+	TrackNumber    string `json:"trackNumber" bson:"trackNumber"`
+	Quality        string `json:"quality" bson:"quality"`
+	QualityVersion int    `json:"qualityVersion" bson:"qualityVersion"`
+	ReleaseGroup   string `json:"releaseGroup" bson:"releaseGroup"`
+}
+
+// LidarrTrackFile is the struct that represents the track file data that is sent from Lidarr.
+type LidarrTrackFile struct {
+	ID             int    `json:"id" bson:"id"`
+	Path           string `json:"path" bson:"path"`
+	Quality        string `json:"quality" bson:"quality"`
+	QualityVersion int    `json:"qualityVersion" bson:"qualityVersion"`
+	ReleaseGroup   string `json:"releaseGroup" bson:"releaseGroup"`
+	SceneName      string `json:"sceneName" bson:"sceneName"`
+	Size           int64  `json:"size" bson:"size"`
+	DateAdded      string `json:"dateAdded" bson:"dateAdded"`
+}
+
+// LidarrRenamedTrackFile is the struct that represents a track file that was renamed by Lidarr.
+type LidarrRenamedTrackFile struct {
+	LidarrTrackFile `bson:",inline"`
+	PreviousPath    string `json:"previousPath" bson:"previousPath"`
+}
+
+// LidarrRelease is the struct that represents the release data that is sent from Lidarr.
+type LidarrRelease struct {
+	Quality           string   `json:"quality" bson:"quality"`
+	QualityVersion    int      `json:"qualityVersion" bson:"qualityVersion"`
+	ReleaseGroup      string   `json:"releaseGroup" bson:"releaseGroup"`
+	ReleaseTitle      string   `json:"releaseTitle" bson:"releaseTitle"`
+	Indexer           string   `json:"indexer" bson:"indexer"`
+	Size              int64    `json:"size" bson:"size"`
+	CustomFormatScore *int     `json:"customFormatScore,omitempty" bson:"customFormatScore,omitempty"`
+	CustomFormats     []string `json:"customFormats,omitempty" bson:"customFormats,omitempty"`
+}
+
+// ToJSON converts the struct to JSON.
+func (p *LidarrWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct.
+func (p *LidarrWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts an HTTP request to the struct.
+func (p *LidarrWebhookData) FromHTTPRequest(r *http.Request) error {
+	err := json.NewDecoder(r.Body).Decode(p)
+	if err != nil {
+		return err
+	}
+	p.ServiceName = "lidarr"
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p LidarrWebhookData) Envelope() EventEnvelope {
+	envelope := servarrEnvelope(p.ServiceName, p.EventType, p.InstanceName, p.IsUpgrade)
+	if p.Artist != nil {
+		envelope.Media = &EventMedia{Type: "artist", Title: p.Artist.Name}
+		// Events about a single album are about that album, the others about the artist
+		album := p.Album
+		if album == nil && len(p.Albums) == 1 {
+			album = &p.Albums[0]
+		}
+		if album != nil {
+			envelope.Media.Type = "album"
+			envelope.Media.Title = album.Title
+		}
+	}
+	return envelope
+}
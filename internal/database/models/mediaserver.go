@@ -0,0 +1,47 @@
+package models
+
+import "strings"
+
+// MediaServerEvent holds the fields that are common to the events sent by the media servers (Plex, Jellyfin, ...). It
+// is stored under the same key for every media server, so playback from all of them can be queried together.
+type MediaServerEvent struct {
+	User        string      `json:"user" bson:"user"`
+	Player      string      `json:"player" bson:"player"`
+	ItemTitle   string      `json:"itemTitle" bson:"itemTitle"`
+	ItemType    string      `json:"itemType" bson:"itemType"`
+	SeriesTitle string      `json:"seriesTitle,omitempty" bson:"seriesTitle,omitempty"`
+	ProviderIDs ProviderIDs `json:"providerIds" bson:"providerIds"`
+}
+
+// ProviderIDs are the IDs of a media item in the metadata providers.
+type ProviderIDs struct {
+	Tmdb string `json:"tmdb,omitempty" bson:"tmdb,omitempty"`
+	Tvdb string `json:"tvdb,omitempty" bson:"tvdb,omitempty"`
+	Imdb string `json:"imdb,omitempty" bson:"imdb,omitempty"`
+}
+
+// normalizeItemType converts the item type reported by a media server to the lowercase form Plex uses (movie, episode, ...).
+func normalizeItemType(itemType string) string {
+	return strings.ToLower(itemType)
+}
+
+// providerIDsFromGUIDs parses Plex style GUIDs, such as "tmdb://9032", into provider IDs.
+func providerIDsFromGUIDs(guids []string) ProviderIDs {
+	ids := ProviderIDs{}
+	for _, guid := range guids {
+		provider, id, found := strings.Cut(guid, "://")
+		if !found {
+			continue
+		}
+
+		switch provider {
+		case "tmdb":
+			ids.Tmdb = id
+		case "tvdb":
+			ids.Tvdb = id
+		case "imdb":
+			ids.Imdb = id
+		}
+	}
+	return ids
+}
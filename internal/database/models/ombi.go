@@ -3,6 +3,8 @@ package models
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -72,3 +74,24 @@ func (p *OmbiWebhookData) FromHTTPRequest(r *http.Request) error {
 	p.CreatedAt = time.Now()
 	return nil
 }
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p OmbiWebhookData) Envelope() EventEnvelope {
+	envelope := requestEnvelope(p.ServiceName, p.NotificationType)
+	envelope.Actor = p.RequestedUser
+	if envelope.Category == EventCategoryIssue {
+		envelope.Actor = p.IssueUser
+	}
+
+	if p.Title != "" {
+		envelope.Media = &EventMedia{Type: strings.ToLower(p.Type), Title: p.Title}
+		envelope.Media.Year, _ = strconv.Atoi(p.Year)
+		// The provider ID is the TMDb ID of movies and the TVDb ID of shows
+		if envelope.Media.Type == "movie" {
+			envelope.Media.Tmdb = p.ProviderID
+		} else {
+			envelope.Media.Tvdb = p.ProviderID
+		}
+	}
+	return envelope
+}
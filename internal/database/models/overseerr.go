@@ -0,0 +1,201 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// overseerrNotificationTypes maps the Overseerr/Jellyseerr notification types onto the Ombi notification types, so
+// request analytics don't need to know which frontend was used.
+var overseerrNotificationTypes = map[string]string{
+	"MEDIA_PENDING":        "NewRequest",
+	"MEDIA_AUTO_REQUESTED": "NewRequest",
+	"MEDIA_APPROVED":       "RequestApproved",
+	"MEDIA_AUTO_APPROVED":  "RequestApproved",
+	"MEDIA_AVAILABLE":      "RequestAvailable",
+	"MEDIA_DECLINED":       "RequestDeclined",
+	"MEDIA_FAILED":         "ItemAddedToFaultQueue",
+	"ISSUE_CREATED":        "Issue",
+	"ISSUE_REOPENED":       "Issue",
+	"ISSUE_COMMENT":        "IssueComment",
+	"ISSUE_RESOLVED":       "IssueResolved",
+	"TEST_NOTIFICATION":    "Test",
+}
+
+// OverseerrWebhookData is the struct that represents the data sent by Overseerr and Jellyseerr using the default
+// webhook JSON payload template. The fields named after the Ombi fields are filled in from the template fields so
+// both can be queried the same way.
+type OverseerrWebhookData struct {
+	OverseerrNotificationType string            `json:"notification_type" bson:"notification_type"`
+	Event                     string            `json:"event" bson:"event"`
+	Subject                   string            `json:"subject" bson:"subject"`
+	Message                   string            `json:"message" bson:"message"`
+	Image                     string            `json:"image" bson:"image"`
+	Media                     *OverseerrMedia   `json:"media,omitempty" bson:"media,omitempty"`
+	Request                   *OverseerrRequest `json:"request,omitempty" bson:"request,omitempty"`
+	Issue                     *OverseerrIssue   `json:"issue,omitempty" bson:"issue,omitempty"`
+	Comment                   *OverseerrComment `json:"comment,omitempty" bson:"comment,omitempty"`
+	Extra                     []OverseerrExtra  `json:"extra,omitempty" bson:"extra,omitempty"`
+
+	// Fields shared with OmbiWebhookData
+	RequestID        string `json:"requestId" bson:"requestId"`
+	RequestedUser    string `json:"requestedUser" bson:"requestedUser"`
+	Title            string `json:"title" bson:"title"`
+	Type             string `json:"type" bson:"type"`
+	RequestStatus    string `json:"requestStatus" bson:"requestStatus"`
+	ProviderID       string `json:"providerId" bson:"providerId"`
+	PosterImage      string `json:"posterImage" bson:"posterImage"`
+	IssueSubject     string `json:"issueSubject" bson:"issueSubject"`
+	IssueDescription string `json:"issueDescription" bson:"issueDescription"`
+	IssueCategory    string `json:"issueCategory" bson:"issueCategory"`
+	IssueStatus      string `json:"issueStatus" bson:"issueStatus"`
+	IssueUser        string `json:"issueUser" bson:"issueUser"`
+	NewIssueComment  string `json:"newIssueComment" bson:"newIssueComment"`
+	DenyReason       string `json:"denyReason" bson:"denyReason"`
+	NotificationType string `json:"notificationType" bson:"notificationType"`
+
+	ServiceName string    `json:"serviceName" bson:"serviceName"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// OverseerrMedia is the struct that represents the {{media}} object of the webhook payload.
+type OverseerrMedia struct {
+	MediaType string `json:"media_type" bson:"media_type"`
+	TmdbID    string `json:"tmdbId" bson:"tmdbId"`
+	TvdbID    string `json:"tvdbId" bson:"tvdbId"`
+	Status    string `json:"status" bson:"status"`
+	Status4k  string `json:"status4k" bson:"status4k"`
+}
+
+// OverseerrRequest is the struct that represents the {{request}} object of the webhook payload.
+type OverseerrRequest struct {
+	RequestID           string `json:"request_id" bson:"request_id"`
+	RequestedByEmail    string `json:"requestedBy_email" bson:"requestedBy_email"`
+	RequestedByUsername string `json:"requestedBy_username" bson:"requestedBy_username"`
+	RequestedByAvatar   string `json:"requestedBy_avatar" bson:"requestedBy_avatar"`
+}
+
+// OverseerrIssue is the struct that represents the {{issue}} object of the webhook payload.
+type OverseerrIssue struct {
+	IssueID            string `json:"issue_id" bson:"issue_id"`
+	IssueType          string `json:"issue_type" bson:"issue_type"`
+	IssueStatus        string `json:"issue_status" bson:"issue_status"`
+	ReportedByEmail    string `json:"reportedBy_email" bson:"reportedBy_email"`
+	ReportedByUsername string `json:"reportedBy_username" bson:"reportedBy_username"`
+	ReportedByAvatar   string `json:"reportedBy_avatar" bson:"reportedBy_avatar"`
+}
+
+// OverseerrComment is the struct that represents the {{comment}} object of the webhook payload.
+type OverseerrComment struct {
+	CommentMessage      string `json:"comment_message" bson:"comment_message"`
+	CommentedByEmail    string `json:"commentedBy_email" bson:"commentedBy_email"`
+	CommentedByUsername string `json:"commentedBy_username" bson:"commentedBy_username"`
+	CommentedByAvatar   string `json:"commentedBy_avatar" bson:"commentedBy_avatar"`
+}
+
+// OverseerrExtra is the struct that represents an entry of the {{extra}} array of the webhook payload.
+type OverseerrExtra struct {
+	Name  string `json:"name" bson:"name"`
+	Value string `json:"value" bson:"value"`
+}
+
+// ToJSON converts the struct to JSON
+func (p *OverseerrWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct
+func (p *OverseerrWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts the HTTP request to struct
+func (p *OverseerrWebhookData) FromHTTPRequest(r *http.Request) error {
+	err := json.NewDecoder(r.Body).Decode(p)
+	if err != nil {
+		return err
+	}
+	p.mapOmbiFields()
+	p.ServiceName = "overseerr"
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p OverseerrWebhookData) Envelope() EventEnvelope {
+	envelope := requestEnvelope(p.ServiceName, p.NotificationType)
+	envelope.EventType = p.OverseerrNotificationType
+	if p.OverseerrNotificationType == "ISSUE_REOPENED" {
+		envelope.Action = "reopened"
+	}
+
+	envelope.Actor = p.RequestedUser
+	if envelope.Category == EventCategoryIssue {
+		envelope.Actor = p.IssueUser
+	}
+
+	if p.Media != nil {
+		envelope.Media = &EventMedia{
+			Type:        p.Media.MediaType,
+			Title:       p.Subject,
+			ProviderIDs: ProviderIDs{Tmdb: p.Media.TmdbID, Tvdb: p.Media.TvdbID},
+		}
+	}
+	return envelope
+}
+
+// mapOmbiFields fills in the fields shared with OmbiWebhookData from the template fields.
+func (p *OverseerrWebhookData) mapOmbiFields() {
+	p.Title = p.Subject
+	p.PosterImage = p.Image
+	p.NotificationType = p.OverseerrNotificationType
+	if notificationType, ok := overseerrNotificationTypes[p.OverseerrNotificationType]; ok {
+		p.NotificationType = notificationType
+	}
+
+	if p.Media != nil {
+		p.Type = p.Media.MediaType
+		p.RequestStatus = p.Media.Status
+		p.ProviderID = p.Media.TmdbID
+		if p.Media.MediaType == "tv" && p.Media.TvdbID != "" {
+			p.ProviderID = p.Media.TvdbID
+		}
+	}
+
+	if p.Request != nil {
+		p.RequestID = p.Request.RequestID
+		p.RequestedUser = p.Request.RequestedByUsername
+		if p.RequestedUser == "" {
+			p.RequestedUser = p.Request.RequestedByEmail
+		}
+	}
+
+	if p.Issue != nil {
+		p.IssueSubject = p.Subject
+		p.IssueDescription = p.Message
+		p.IssueCategory = p.Issue.IssueType
+		p.IssueStatus = p.Issue.IssueStatus
+		p.IssueUser = p.Issue.ReportedByUsername
+		if p.IssueUser == "" {
+			p.IssueUser = p.Issue.ReportedByEmail
+		}
+	}
+
+	if p.Comment != nil {
+		p.NewIssueComment = p.Comment.CommentMessage
+	}
+
+	// The decline reason is not part of the default template, but is sent as an extra when available
+	for _, extra := range p.Extra {
+		if strings.Contains(strings.ToLower(extra.Name), "reason") {
+			p.DenyReason = extra.Value
+			break
+		}
+	}
+}
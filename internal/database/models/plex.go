@@ -34,6 +34,9 @@ type PlexWebhookData struct {
 		Studio                string  `json:"studio" bson:"studio"`
 		Type                  string  `json:"type" bson:"type"`
 		Title                 string  `json:"title" bson:"title"`
+		GrandparentTitle      string  `json:"grandparentTitle" bson:"grandparentTitle"`
+		ParentIndex           int     `json:"parentIndex" bson:"parentIndex"`
+		Index                 int     `json:"index" bson:"index"`
 		LibrarySectionTitle   string  `json:"librarySectionTitle" bson:"librarySectionTitle"`
 		LibrarySectionID      int     `json:"librarySectionID" bson:"librarySectionID"`
 		LibrarySectionKey     string  `json:"librarySectionKey" bson:"librarySectionKey"`
@@ -109,8 +112,11 @@ type PlexWebhookData struct {
 			Thumb  string `json:"thumb" bson:"thumb"`
 		} `json:"Producer" bson:"Producer"`
 	} `json:"Metadata" bson:"Metadata"`
-	ServiceName string    `json:"serviceName" bson:"serviceName"`
-	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	// ThumbnailHash is the hash of the thumbnail sent with the event, see StoreThumbnail
+	ThumbnailHash string           `json:"thumbnailHash,omitempty" bson:"thumbnailHash,omitempty"`
+	MediaServer   MediaServerEvent `json:"mediaServer" bson:"mediaServer"`
+	ServiceName   string           `json:"serviceName" bson:"serviceName"`
+	CreatedAt     time.Time        `json:"createdAt" bson:"createdAt"`
 }
 
 // ToJSON converts the PlexWebhookData struct to a JSON string
@@ -138,8 +144,42 @@ func (p *PlexWebhookData) FromHTTPRequest(r *http.Request) error {
 		return err
 	}
 
+	p.MediaServer = p.toMediaServerEvent()
 	p.ServiceName = "plex"
 	p.CreatedAt = time.Now()
 
 	return nil
 }
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p PlexWebhookData) Envelope() EventEnvelope {
+	envelope := mediaServerEnvelope(p.ServiceName, p.Event, p.MediaServer)
+	envelope.Instance = p.Server.Title
+	if envelope.Media != nil {
+		envelope.Media.Year = p.Metadata.Year
+	}
+	return envelope
+}
+
+// toMediaServerEvent returns the fields that are shared with the other media servers.
+func (p *PlexWebhookData) toMediaServerEvent() MediaServerEvent {
+	guids := []string{}
+	for _, guid := range p.Metadata.GUID {
+		guids = append(guids, guid.ID)
+	}
+
+	event := MediaServerEvent{
+		User:        p.Account.Title,
+		Player:      p.Player.Title,
+		ItemTitle:   p.Metadata.Title,
+		ItemType:    normalizeItemType(p.Metadata.Type),
+		ProviderIDs: providerIDsFromGUIDs(guids),
+	}
+
+	// The grandparent of a track is the artist, only episodes belong to a series
+	if event.ItemType == "episode" {
+		event.SeriesTitle = p.Metadata.GrandparentTitle
+	}
+
+	return event
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"plex_monitor/internal/database"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// ProwlarrGrabLinkWindow is how far apart a Prowlarr grab and the grab of the same release by a Servarr
+	// application can be for them to be linked together.
+	ProwlarrGrabLinkWindow = 30 * time.Minute
+)
+
+// ProwlarrWebhookData is the struct that represents the data that is sent from Prowlarr.
+type ProwlarrWebhookData struct {
+	Release            *ProwlarrRelease `json:"release,omitempty" bson:"release,omitempty"`
+	Trigger            *string          `json:"trigger,omitempty" bson:"trigger,omitempty"`
+	Source             *string          `json:"source,omitempty" bson:"source,omitempty"`
+	Host               *string          `json:"host,omitempty" bson:"host,omitempty"`
+	DownloadClient     *string          `json:"downloadClient,omitempty" bson:"downloadClient,omitempty"`
+	DownloadClientType *string          `json:"downloadClientType,omitempty" bson:"downloadClientType,omitempty"`
+	Message            *string          `json:"message,omitempty" bson:"message,omitempty"`
+	PreviousVersion    *string          `json:"previousVersion,omitempty" bson:"previousVersion,omitempty"`
+	NewVersion         *string          `json:"newVersion,omitempty" bson:"newVersion,omitempty"`
+	EventType          string           `json:"eventType" bson:"eventType"`
+	InstanceName       string           `json:"instanceName" bson:"instanceName"`
+	ApplicationURL     string           `json:"applicationUrl" bson:"applicationUrl"`
+	ServiceName        string           `json:"serviceName" bson:"serviceName"`
+	CreatedAt          time.Time        `json:"createdAt" bson:"createdAt"`
+}
+
+// ProwlarrRelease is the struct that represents the release data that is sent from Prowlarr.
+type ProwlarrRelease struct {
+	ReleaseTitle string   `json:"releaseTitle" bson:"releaseTitle"`
+	Indexer      string   `json:"indexer" bson:"indexer"`
+	Size         int64    `json:"size" bson:"size"`
+	Categories   []string `json:"categories" bson:"categories"`
+}
+
+// ToJSON converts the struct to JSON.
+func (p *ProwlarrWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct.
+func (p *ProwlarrWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts an HTTP request to the struct.
+func (p *ProwlarrWebhookData) FromHTTPRequest(r *http.Request) error {
+	err := json.NewDecoder(r.Body).Decode(p)
+	if err != nil {
+		return err
+	}
+	p.ServiceName = "prowlarr"
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope. Grabs are attributed to the application or
+// user that searched for the release.
+func (p ProwlarrWebhookData) Envelope() EventEnvelope {
+	envelope := servarrEnvelope(p.ServiceName, p.EventType, p.InstanceName, nil)
+	if p.Source != nil {
+		envelope.Actor = *p.Source
+	}
+	return envelope
+}
+
+// FindProwlarrGrab returns the ID of the most recent Prowlarr grab of the supplied release title that happened within
+// ProwlarrGrabLinkWindow of the supplied time, or nil if there is none.
+func FindProwlarrGrab(releaseTitle string, at time.Time) (*primitive.ObjectID, error) {
+	filter := bson.M{
+		"service":                      "prowlarr",
+		"eventType":                    "Grab",
+		"payload.release.releaseTitle": releaseTitle,
+		"receivedAt":                   bson.M{"$gte": at.Add(-ProwlarrGrabLinkWindow), "$lte": at.Add(ProwlarrGrabLinkWindow)},
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "receivedAt", Value: -1}}).SetProjection(bson.M{"_id": 1})
+
+	var result struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, filter, opts).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &result.ID, nil
+}
+
+// LinkServarrGrabs links grabs of the supplied release title by the Servarr applications to the Prowlarr grab. This
+// covers the case where the Servarr application's webhook arrived before the Prowlarr one.
+func LinkServarrGrabs(prowlarrGrabID primitive.ObjectID, releaseTitle string, at time.Time) error {
+	filter := bson.M{
+		"service":                      bson.M{"$ne": "prowlarr"},
+		"eventType":                    "Grab",
+		"payload.release.releaseTitle": releaseTitle,
+		"payload.prowlarrGrabId":       bson.M{"$exists": false},
+		"receivedAt":                   bson.M{"$gte": at.Add(-ProwlarrGrabLinkWindow), "$lte": at.Add(ProwlarrGrabLinkWindow)},
+	}
+	update := bson.M{"$set": bson.M{"payload.prowlarrGrabId": prowlarrGrabID}}
+
+	_, err := database.DB.Collection(database.WebhookCollectionName).UpdateMany(database.Ctx, filter, update)
+	return err
+}
@@ -4,23 +4,26 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // RadarrWebhookData is the struct that represents the data that is sent from Radarr.
 type RadarrWebhookData struct {
-	Movie              Movie         `json:"movie" bson:"movie"`
-	RemoteMovie        *RemoteMovie  `json:"remoteMovie,omitempty" bson:"remoteMovie,omitempty"`
-	Release            *MovieRelease `json:"release,omitempty" bson:"release,omitempty"`
-	MovieFile          *MovieFile    `json:"movieFile,omitempty" bson:"movieFile,omitempty"`
-	DownloadClient     *string       `json:"downloadClient,omitempty" bson:"downloadClient,omitempty"`
-	DownloadClientType *string       `json:"downloadClientType,omitempty" bson:"downloadClientType,omitempty"`
-	DownloadID         *string       `json:"downloadId,omitempty" bson:"downloadId,omitempty"`
-	CustomFormatInfo   *CustomFormat `json:"customFormatInfo,omitempty" bson:"customFormatInfo,omitempty"`
-	EventType          string        `json:"eventType" bson:"eventType"`
-	InstanceName       string        `json:"instanceName" bson:"instanceName"`
-	ApplicationURL     string        `json:"applicationUrl" bson:"applicationUrl"`
-	ServiceName        string        `json:"serviceName" bson:"serviceName"`
-	CreatedAt          time.Time     `json:"createdAt" bson:"createdAt"`
+	Movie              Movie               `json:"movie" bson:"movie"`
+	RemoteMovie        *RemoteMovie        `json:"remoteMovie,omitempty" bson:"remoteMovie,omitempty"`
+	Release            *MovieRelease       `json:"release,omitempty" bson:"release,omitempty"`
+	MovieFile          *MovieFile          `json:"movieFile,omitempty" bson:"movieFile,omitempty"`
+	DownloadClient     *string             `json:"downloadClient,omitempty" bson:"downloadClient,omitempty"`
+	DownloadClientType *string             `json:"downloadClientType,omitempty" bson:"downloadClientType,omitempty"`
+	DownloadID         *string             `json:"downloadId,omitempty" bson:"downloadId,omitempty"`
+	CustomFormatInfo   *CustomFormat       `json:"customFormatInfo,omitempty" bson:"customFormatInfo,omitempty"`
+	ProwlarrGrabID     *primitive.ObjectID `json:"prowlarrGrabId,omitempty" bson:"prowlarrGrabId,omitempty"`
+	EventType          string              `json:"eventType" bson:"eventType"`
+	InstanceName       string              `json:"instanceName" bson:"instanceName"`
+	ApplicationURL     string              `json:"applicationUrl" bson:"applicationUrl"`
+	ServiceName        string              `json:"serviceName" bson:"serviceName"`
+	CreatedAt          time.Time           `json:"createdAt" bson:"createdAt"`
 }
 
 // Movie is the struct that represents the movie data that is sent from Radarr.
@@ -114,3 +117,17 @@ func (p *RadarrWebhookData) FromHTTPRequest(r *http.Request) error {
 	p.CreatedAt = time.Now()
 	return nil
 }
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p RadarrWebhookData) Envelope() EventEnvelope {
+	envelope := servarrEnvelope(p.ServiceName, p.EventType, p.InstanceName, nil)
+	if p.Movie.Title != "" {
+		envelope.Media = &EventMedia{
+			Type:        "movie",
+			Title:       p.Movie.Title,
+			Year:        p.Movie.Year,
+			ProviderIDs: ProviderIDs{Tmdb: providerID(p.Movie.TmdbID), Imdb: p.Movie.ImdbID},
+		}
+	}
+	return envelope
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReadarrWebhookData is the struct that represents the data that is sent from Readarr.
+type ReadarrWebhookData struct {
+	Author             *ReadarrAuthor           `json:"author,omitempty" bson:"author,omitempty"`
+	Book               *ReadarrBook             `json:"book,omitempty" bson:"book,omitempty"`
+	Books              []ReadarrBook            `json:"books,omitempty" bson:"books,omitempty"`
+	BookFile           *ReadarrBookFile         `json:"bookFile,omitempty" bson:"bookFile,omitempty"`
+	BookFiles          []ReadarrBookFile        `json:"bookFiles,omitempty" bson:"bookFiles,omitempty"`
+	RenamedBookFiles   []ReadarrRenamedBookFile `json:"renamedBookFiles,omitempty" bson:"renamedBookFiles,omitempty"`
+	Release            *ReadarrRelease          `json:"release,omitempty" bson:"release,omitempty"`
+	IsUpgrade          *bool                    `json:"isUpgrade,omitempty" bson:"isUpgrade,omitempty"`
+	DownloadClient     *string                  `json:"downloadClient,omitempty" bson:"downloadClient,omitempty"`
+	DownloadClientType *string                  `json:"downloadClientType,omitempty" bson:"downloadClientType,omitempty"`
+	DownloadID         *string                  `json:"downloadId,omitempty" bson:"downloadId,omitempty"`
+	// DeletedFiles is a list of book files on imports, but a boolean on AuthorDelete and BookDelete events.
+	DeletedFiles   interface{}         `json:"deletedFiles,omitempty" bson:"deletedFiles,omitempty"`
+	DeleteReason   *string             `json:"deleteReason,omitempty" bson:"deleteReason,omitempty"`
+	ProwlarrGrabID *primitive.ObjectID `json:"prowlarrGrabId,omitempty" bson:"prowlarrGrabId,omitempty"`
+	EventType      string              `json:"eventType" bson:"eventType"`
+	InstanceName   string              `json:"instanceName" bson:"instanceName"`
+	ApplicationURL string              `json:"applicationUrl" bson:"applicationUrl"`
+	ServiceName    string              `json:"serviceName" bson:"serviceName"`
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// ReadarrAuthor is the struct that represents the author data that is sent from Readarr.
+type ReadarrAuthor struct {
+	ID          int    `json:"id" bson:"id"`
+	Name        string `json:"name" bson:"name"`
+	Path        string `json:"path" bson:"path"`
+	GoodreadsID string `json:"goodreadsId" bson:"goodreadsId"`
+}
+
+// ReadarrBook is the struct that represents the book data that is sent from Readarr.
+type ReadarrBook struct {
+	ID          int    `json:"id" bson:"id"`
+	GoodreadsID string `json:"goodreadsId" bson:"goodreadsId"`
+	Title       string `json:"title" bson:"title"`
+	ReleaseDate string `json:"releaseDate" bson:"releaseDate"`
+}
+
+// ReadarrBookFile is the struct that represents the book file data that is sent from Readarr.
+type ReadarrBookFile struct {
+	ID             int    `json:"id" bson:"id"`
+	Path           string `json:"path" bson:"path"`
+	Quality        string `json:"quality" bson:"quality"`
+	QualityVersion int    `json:"qualityVersion" bson:"qualityVersion"`
+	ReleaseGroup   string `json:"releaseGroup" bson:"releaseGroup"`
+	SceneName      string `json:"sceneName" bson:"sceneName"`
+	Size           int64  `json:"size" bson:"size"`
+	DateAdded      string `json:"dateAdded" bson:"dateAdded"`
+}
+
+// ReadarrRenamedBookFile is the struct that represents a book file that was renamed by Readarr.
+type ReadarrRenamedBookFile struct {
+	ReadarrBookFile `bson:",inline"`
+	PreviousPath    string `json:"previousPath" bson:"previousPath"`
+}
+
+// ReadarrRelease is the struct that represents the release data that is sent from Readarr.
+type ReadarrRelease struct {
+	Quality           string   `json:"quality" bson:"quality"`
+	QualityVersion    int      `json:"qualityVersion" bson:"qualityVersion"`
+	ReleaseGroup      string   `json:"releaseGroup" bson:"releaseGroup"`
+	ReleaseTitle      string   `json:"releaseTitle" bson:"releaseTitle"`
+	Indexer           string   `json:"indexer" bson:"indexer"`
+	Size              int64    `json:"size" bson:"size"`
+	CustomFormatScore *int     `json:"customFormatScore,omitempty" bson:"customFormatScore,omitempty"`
+	CustomFormats     []string `json:"customFormats,omitempty" bson:"customFormats,omitempty"`
+}
+
+// ToJSON converts the struct to JSON.
+func (p *ReadarrWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct.
+func (p *ReadarrWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts an HTTP request to the struct.
+func (p *ReadarrWebhookData) FromHTTPRequest(r *http.Request) error {
+	err := json.NewDecoder(r.Body).Decode(p)
+	if err != nil {
+		return err
+	}
+	p.ServiceName = "readarr"
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p ReadarrWebhookData) Envelope() EventEnvelope {
+	envelope := servarrEnvelope(p.ServiceName, p.EventType, p.InstanceName, p.IsUpgrade)
+	if p.Author != nil {
+		envelope.Media = &EventMedia{Type: "author", Title: p.Author.Name}
+		// Events about a single book are about that book, the others about the author
+		book := p.Book
+		if book == nil && len(p.Books) == 1 {
+			book = &p.Books[0]
+		}
+		if book != nil {
+			envelope.Media.Type = "book"
+			envelope.Media.Title = book.Title
+		}
+	}
+	return envelope
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -10,15 +11,27 @@ import (
 
 // ServarrHealthData is the struct that represents the health data that is sent from Radarr.
 type ServarrHealthData struct {
-	Level          string    `json:"level" bson:"level"`
-	Message        string    `json:"message" bson:"message"`
-	Type           string    `json:"type" bson:"type"`
-	WikiURL        string    `json:"wikiUrl" bson:"wikiUrl"`
-	EventType      string    `json:"eventType" bson:"eventType"`
-	InstanceName   *string   `json:"instanceName,omitempty" bson:"instanceName,omitempty"`
-	ApplicationURL *string   `json:"applicationUrl,omitempty" bson:"applicationUrl,omitempty"`
-	ServiceName    string    `json:"serviceName" bson:"serviceName"`
-	CreatedAt      time.Time `json:"createdAt" bson:"createdAt"`
+	Level           string           `json:"level" bson:"level"`
+	Message         string           `json:"message" bson:"message"`
+	Type            string           `json:"type" bson:"type"`
+	WikiURL         string           `json:"wikiUrl" bson:"wikiUrl"`
+	EventType       string           `json:"eventType" bson:"eventType"`
+	InstanceName    *string          `json:"instanceName,omitempty" bson:"instanceName,omitempty"`
+	ApplicationURL  *string          `json:"applicationUrl,omitempty" bson:"applicationUrl,omitempty"`
+	IndexerFailures []IndexerFailure `json:"indexerFailures,omitempty" bson:"indexerFailures,omitempty"`
+	ServiceName     string           `json:"serviceName" bson:"serviceName"`
+	CreatedAt       time.Time        `json:"createdAt" bson:"createdAt"`
+}
+
+// AllIndexers is the indexer name used for failures that apply to every configured indexer.
+const AllIndexers = "*"
+
+// IndexerFailure is a single indexer that was reported as failing by a health check.
+type IndexerFailure struct {
+	Indexer  string `json:"indexer" bson:"indexer"`
+	Check    string `json:"check" bson:"check"`
+	Level    string `json:"level" bson:"level"`
+	LongTerm bool   `json:"longTerm" bson:"longTerm"`
 }
 
 // FromHTTPRequest converts an HTTP request to the struct.
@@ -27,6 +40,53 @@ func (p *ServarrHealthData) FromHTTPRequest(r *http.Request) error {
 	if err != nil {
 		return err
 	}
+	p.IndexerFailures = p.ParseIndexerFailures()
 	p.CreatedAt = time.Now()
 	return nil
 }
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p ServarrHealthData) Envelope() EventEnvelope {
+	instance := ""
+	if p.InstanceName != nil {
+		instance = *p.InstanceName
+	}
+	envelope := servarrEnvelope(p.ServiceName, p.EventType, instance, nil)
+	envelope.Category = EventCategoryHealth
+	return envelope
+}
+
+// ParseIndexerFailures extracts the failing indexers from an indexer health check message, for example
+// "Indexers unavailable due to failures for more than 6 hours: indexerA, indexerB". It returns nil for
+// health checks that are not about indexers.
+func (p *ServarrHealthData) ParseIndexerFailures() []IndexerFailure {
+	if !strings.HasPrefix(p.Type, "Indexer") {
+		return nil
+	}
+
+	longTerm := strings.Contains(p.Type, "LongTerm")
+	newFailure := func(indexer string) IndexerFailure {
+		return IndexerFailure{Indexer: indexer, Check: p.Type, Level: p.Level, LongTerm: longTerm}
+	}
+
+	// e.g. "All indexers are unavailable due to failures"
+	if strings.HasPrefix(strings.ToLower(p.Message), "all indexers") {
+		return []IndexerFailure{newFailure(AllIndexers)}
+	}
+
+	i := strings.LastIndex(p.Message, ": ")
+	if i == -1 {
+		return nil
+	}
+
+	failures := []IndexerFailure{}
+	for _, indexer := range strings.Split(p.Message[i+2:], ",") {
+		indexer = strings.TrimSpace(indexer)
+		if indexer == "" {
+			continue
+		}
+		failures = append(failures, newFailure(indexer))
+	}
+
+	return failures
+}
@@ -2,28 +2,247 @@ package models
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"plex_monitor/internal/database"
+	"plex_monitor/internal/utils"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var (
+	// ErrInvalidServiceKey is the error that is returned when a webhook key does not match any active service key.
+	ErrInvalidServiceKey = errors.New("invalid service key")
+)
+
+// ServiceTypes are the types of the services that are built into the webhook entrypoint, which is the value of its
+// "service" query parameter. Services registered from outside of the repository add to these (see
+// webhook.Register).
+var ServiceTypes = []string{
+	"autobrr", "bazarr", "deluge", "emby", "generic", "jellyfin", "jellyseerr", "lidarr", "nzbget", "ombi", "overseerr",
+	"plex", "prowlarr", "qbittorrent", "radarr", "readarr", "sabnzbd", "sonarr", "tautulli", "tdarr", "transmission",
+	"unmanic",
+}
+
+// IsServiceType checks if the service type is one of ServiceTypes.
+func IsServiceType(serviceType string) bool {
+	for _, t := range ServiceTypes {
+		if t == serviceType {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceKey is a hashed webhook key that has been issued to a service. The fingerprint is the SHA-256 hash of the key,
+// which finds the key of a request without comparing it to every argon2 hash. Keys are random, so the fingerprint
+// doesn't make them easier to guess.
+type ServiceKey struct {
+	HashedKey   string     `bson:"hashed_key"`
+	Fingerprint string     `bson:"fingerprint"`
+	CreatedAt   time.Time  `bson:"created_at"`
+	ExpiresAt   *time.Time `bson:"expires_at,omitempty"`
+	RevokedAt   *time.Time `bson:"revoked_at,omitempty"`
+}
+
+// IsActive checks if the key can still be used to authenticate webhooks at the supplied time.
+func (k ServiceKey) IsActive(at time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	if k.ExpiresAt != nil && !at.Before(*k.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
 // ServiceData is the struct that represents the service data that is stored in the database.
 type ServiceData struct {
-	ID          string    `bson:"_id"`
-	ServiceName string    `bson:"service_name"`
-	Config      bson.M    `bson:"config"`
-	CreatedAt   time.Time `bson:"created_at"`
-	CreatedBy   string    `bson:"created_by"`
-	UpdatedAt   time.Time `bson:"updated_at"`
-	UpdatedBy   string    `bson:"updated_by"`
+	ID          string       `bson:"_id"`
+	ServiceName string       `bson:"service_name"`
+	ServiceType string       `bson:"service_type"`
+	Instance    string       `bson:"instance"`
+	Config      bson.M       `bson:"config"`
+	Keys        []ServiceKey `bson:"keys"`
+	CreatedAt   time.Time    `bson:"created_at"`
+	CreatedBy   string       `bson:"created_by"`
+	UpdatedAt   time.Time    `bson:"updated_at"`
+	UpdatedBy   string       `bson:"updated_by"`
+	DeletedAt   *time.Time   `bson:"deleted_at,omitempty"`
+	DeletedBy   *string      `bson:"deleted_by,omitempty"`
+}
+
+// CheckKey checks that the supplied key matches one of the active hashed keys for the service. Only the keys with the
+// fingerprint of the supplied key are compared to it.
+func (s ServiceData) CheckKey(key string) bool {
+	now := time.Now()
+	fingerprint := keyFingerprint(key)
+	for _, k := range s.Keys {
+		if k.IsActive(now) && k.Fingerprint == fingerprint && utils.CompareStringToHash(key, k.HashedKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyFingerprint returns the fingerprint of the webhook key.
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ConfigMap returns the object stored under the supplied key of the service config, and an empty map if the key is
+// missing or isn't an object.
+func (s ServiceData) ConfigMap(key string) map[string]interface{} {
+	result := map[string]interface{}{}
+
+	switch value := s.Config[key].(type) {
+	case bson.M:
+		for k, v := range value {
+			result[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range value {
+			result[k] = v
+		}
+	case bson.D:
+		for _, e := range value {
+			result[e.Key] = e.Value
+		}
+	}
+	return result
+}
+
+// ConfigStringMap returns the object stored under the supplied key of the service config as a map of strings. Values
+// that aren't strings are skipped, and a missing key returns an empty map.
+func (s ServiceData) ConfigStringMap(key string) map[string]string {
+	result := map[string]string{}
+	for k, v := range s.ConfigMap(key) {
+		if str, ok := v.(string); ok {
+			result[k] = str
+		}
+	}
+	return result
+}
+
+// newServiceKey generates a new webhook key and returns it along with its hashed form.
+func newServiceKey() (string, ServiceKey, error) {
+	key, err := utils.GenerateRandomKey()
+	if err != nil {
+		return "", ServiceKey{}, err
+	}
+
+	serviceKey, err := HashServiceKey(key)
+	if err != nil {
+		return "", ServiceKey{}, err
+	}
+
+	return key, serviceKey, nil
+}
+
+// HashServiceKey returns the hashed form of the supplied webhook key, as it is stored with the service.
+func HashServiceKey(key string) (ServiceKey, error) {
+	hashedKey, err := utils.HashString(key)
+	if err != nil {
+		return ServiceKey{}, err
+	}
+
+	return ServiceKey{HashedKey: string(hashedKey), Fingerprint: keyFingerprint(key), CreatedAt: time.Now()}, nil
+}
+
+// CreateService registers a new service instance and returns it along with its plaintext webhook key. The key is
+// only stored hashed, so it cannot be retrieved again later.
+func CreateService(name string, serviceType string, instance string, config bson.M, createdBy string) (ServiceData, string, error) {
+	key, serviceKey, err := newServiceKey()
+	if err != nil {
+		return ServiceData{}, "", err
+	}
+
+	if config == nil {
+		config = bson.M{}
+	}
+
+	now := time.Now()
+	service := ServiceData{
+		ID:          primitive.NewObjectID().Hex(),
+		ServiceName: name,
+		ServiceType: serviceType,
+		Instance:    instance,
+		Config:      config,
+		Keys:        []ServiceKey{serviceKey},
+		CreatedAt:   now,
+		CreatedBy:   createdBy,
+		UpdatedAt:   now,
+		UpdatedBy:   createdBy,
+	}
+
+	_, err = database.DB.Collection(database.ServicesCollectionName).InsertOne(context.Background(), service)
+	if err != nil {
+		return ServiceData{}, "", err
+	}
+
+	return service, key, nil
+}
+
+// GetService returns the service with the supplied ID.
+func GetService(id string) (ServiceData, error) {
+	var service ServiceData
+
+	filter := bson.M{"_id": id, "deleted_at": bson.M{"$exists": false}}
+	err := database.DB.Collection(database.ServicesCollectionName).FindOne(context.Background(), filter).Decode(&service)
+	if err != nil {
+		return ServiceData{}, err
+	}
+
+	return service, nil
+}
+
+// RotateKey issues a new webhook key for the service and returns it, along with the time the previous keys expire.
+// Keys that are currently active stay valid for the supplied grace period so the applications sending webhooks can be
+// updated without dropping events.
+func (s *ServiceData) RotateKey(grace time.Duration, updatedBy string) (string, time.Time, error) {
+	key, serviceKey, err := newServiceKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(grace)
+	keys := []ServiceKey{}
+	for _, k := range s.Keys {
+		// Drop keys that can no longer be used, there is no reason to keep their hashes around
+		if !k.IsActive(now) {
+			continue
+		}
+		if k.ExpiresAt == nil || k.ExpiresAt.After(expiresAt) {
+			k.ExpiresAt = &expiresAt
+		}
+		keys = append(keys, k)
+	}
+	keys = append(keys, serviceKey)
+
+	update := bson.M{"$set": bson.M{"keys": keys, "updated_at": now, "updated_by": updatedBy}}
+	_, err = database.DB.Collection(database.ServicesCollectionName).UpdateOne(context.Background(), bson.M{"_id": s.ID}, update)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	s.Keys = keys
+	s.UpdatedAt = now
+	s.UpdatedBy = updatedBy
+
+	return key, expiresAt, nil
 }
 
 // GetAllServices returns all services.
 func GetAllServices() ([]ServiceData, error) {
 	var services []ServiceData
 
-	cursor, err := database.DB.Collection("services").Find(context.Background(), bson.M{"deleted_at": bson.M{"$exists": false}})
+	cursor, err := database.DB.Collection(database.ServicesCollectionName).Find(context.Background(), bson.M{"deleted_at": bson.M{"$exists": false}})
 	if err != nil {
 		return nil, err
 	}
@@ -35,3 +254,26 @@ func GetAllServices() ([]ServiceData, error) {
 
 	return services, nil
 }
+
+// GetServiceByKey returns the service of the supplied type that owns the supplied webhook key. The key is looked up by
+// its fingerprint, so at most one argon2 comparison runs for it.
+func GetServiceByKey(serviceType string, key string) (ServiceData, error) {
+	if key == "" {
+		return ServiceData{}, ErrInvalidServiceKey
+	}
+
+	var service ServiceData
+	filter := bson.M{"service_type": serviceType, "keys.fingerprint": keyFingerprint(key), "deleted_at": bson.M{"$exists": false}}
+	err := database.DB.Collection(database.ServicesCollectionName).FindOne(context.Background(), filter).Decode(&service)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ServiceData{}, ErrInvalidServiceKey
+	}
+	if err != nil {
+		return ServiceData{}, err
+	}
+
+	if !service.CheckKey(key) {
+		return ServiceData{}, ErrInvalidServiceKey
+	}
+	return service, nil
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Episode represents an episode of the TV series.
@@ -246,19 +248,20 @@ type TvRelease struct {
 
 // SonarrWebhookData represents the JSON data structure.
 type SonarrWebhookData struct {
-	Series             Series         `json:"series" bson:"series"`
-	Episodes           []Episode      `json:"episodes" bson:"episodes"`
-	Release            *TvRelease     `json:"release,omitempty" bson:"release,omitempty"`
-	EpisodeFile        *EpisodeFile   `json:"episodeFile,omitempty" bson:"episodeFile,omitempty"`
-	IsUpgrade          *bool          `json:"isUpgrade,omitempty" bson:"isUpgrade,omitempty"`
-	DownloadClient     *string        `json:"downloadClient,omitempty" bson:"downloadClient,omitempty"`
-	DownloadClientType *string        `json:"downloadClientType,omitempty" bson:"downloadClientType,omitempty"`
-	DownloadID         *string        `json:"downloadId,omitempty" bson:"downloadId,omitempty"`
-	DeletedFiles       *[]EpisodeFile `json:"deletedFiles,omitempty" bson:"deletedFiles,omitempty"`
-	DeleteReason       *string        `json:"deleteReason,omitempty" bson:"deleteReason,omitempty"`
-	EventType          string         `json:"eventType" bson:"eventType"`
-	ServiceName        string         `json:"serviceName" bson:"serviceName"`
-	CreatedAt          time.Time      `json:"createdAt" bson:"createdAt"`
+	Series             Series              `json:"series" bson:"series"`
+	Episodes           []Episode           `json:"episodes" bson:"episodes"`
+	Release            *TvRelease          `json:"release,omitempty" bson:"release,omitempty"`
+	EpisodeFile        *EpisodeFile        `json:"episodeFile,omitempty" bson:"episodeFile,omitempty"`
+	IsUpgrade          *bool               `json:"isUpgrade,omitempty" bson:"isUpgrade,omitempty"`
+	DownloadClient     *string             `json:"downloadClient,omitempty" bson:"downloadClient,omitempty"`
+	DownloadClientType *string             `json:"downloadClientType,omitempty" bson:"downloadClientType,omitempty"`
+	DownloadID         *string             `json:"downloadId,omitempty" bson:"downloadId,omitempty"`
+	DeletedFiles       *[]EpisodeFile      `json:"deletedFiles,omitempty" bson:"deletedFiles,omitempty"`
+	DeleteReason       *string             `json:"deleteReason,omitempty" bson:"deleteReason,omitempty"`
+	ProwlarrGrabID     *primitive.ObjectID `json:"prowlarrGrabId,omitempty" bson:"prowlarrGrabId,omitempty"`
+	EventType          string              `json:"eventType" bson:"eventType"`
+	ServiceName        string              `json:"serviceName" bson:"serviceName"`
+	CreatedAt          time.Time           `json:"createdAt" bson:"createdAt"`
 }
 
 // ToJSON returns the JSON encoding of the struct.
@@ -286,3 +289,22 @@ func (p *SonarrWebhookData) FromHTTPRequest(r *http.Request) error {
 	p.CreatedAt = time.Now()
 	return nil
 }
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p SonarrWebhookData) Envelope() EventEnvelope {
+	envelope := servarrEnvelope(p.ServiceName, p.EventType, "", p.IsUpgrade)
+	if p.Series.Title != "" {
+		envelope.Media = &EventMedia{
+			Type:        "series",
+			Title:       p.Series.Title,
+			SeriesTitle: p.Series.Title,
+			ProviderIDs: ProviderIDs{Tvdb: providerID(p.Series.TvdbID), Imdb: p.Series.ImdbID},
+		}
+		// Events about a single episode are about that episode, the others about the series
+		if len(p.Episodes) == 1 {
+			envelope.Media.Type = "episode"
+			envelope.Media.Title = p.Episodes[0].Title
+		}
+	}
+	return envelope
+}
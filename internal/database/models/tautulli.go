@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// TautulliWebhookData is the struct that represents the data sent by the Tautulli webhook notification agent, using
+// the recommended JSON data template from the README.
+type TautulliWebhookData struct {
+	Action                    string           `json:"action" bson:"action"`
+	User                      string           `json:"user" bson:"user"`
+	Username                  string           `json:"username" bson:"username"`
+	Player                    string           `json:"player" bson:"player"`
+	Device                    string           `json:"device" bson:"device"`
+	Platform                  string           `json:"platform" bson:"platform"`
+	Product                   string           `json:"product" bson:"product"`
+	IPAddress                 string           `json:"ip_address" bson:"ip_address"`
+	SessionKey                string           `json:"session_key" bson:"session_key"`
+	RatingKey                 string           `json:"rating_key" bson:"rating_key"`
+	Title                     string           `json:"title" bson:"title"`
+	ShowName                  string           `json:"show_name" bson:"show_name"`
+	SeasonNum                 FlexibleInt      `json:"season_num" bson:"season_num"`
+	EpisodeNum                FlexibleInt      `json:"episode_num" bson:"episode_num"`
+	MediaType                 string           `json:"media_type" bson:"media_type"`
+	TheMovieDbID              string           `json:"themoviedb_id" bson:"themoviedb_id"`
+	TheTvDbID                 string           `json:"thetvdb_id" bson:"thetvdb_id"`
+	ImdbID                    string           `json:"imdb_id" bson:"imdb_id"`
+	ProgressPercent           FlexibleInt      `json:"progress_percent" bson:"progress_percent"`
+	StreamCount               FlexibleInt      `json:"stream_count" bson:"stream_count"`
+	StreamBandwidth           FlexibleInt      `json:"stream_bandwidth" bson:"stream_bandwidth"`
+	StreamLocation            string           `json:"stream_location" bson:"stream_location"`
+	QualityProfile            string           `json:"quality_profile" bson:"quality_profile"`
+	TranscodeDecision         string           `json:"transcode_decision" bson:"transcode_decision"`
+	VideoDecision             string           `json:"video_decision" bson:"video_decision"`
+	AudioDecision             string           `json:"audio_decision" bson:"audio_decision"`
+	SubtitleDecision          string           `json:"subtitle_decision" bson:"subtitle_decision"`
+	StreamContainerDecision   string           `json:"stream_container_decision" bson:"stream_container_decision"`
+	VideoResolution           string           `json:"video_resolution" bson:"video_resolution"`
+	StreamVideoResolution     string           `json:"stream_video_resolution" bson:"stream_video_resolution"`
+	VideoCodec                string           `json:"video_codec" bson:"video_codec"`
+	StreamVideoCodec          string           `json:"stream_video_codec" bson:"stream_video_codec"`
+	AudioCodec                string           `json:"audio_codec" bson:"audio_codec"`
+	StreamAudioCodec          string           `json:"stream_audio_codec" bson:"stream_audio_codec"`
+	TranscodeHardwareDecoding FlexibleInt      `json:"transcode_hw_decoding" bson:"transcode_hw_decoding"`
+	TranscodeHardwareEncoding FlexibleInt      `json:"transcode_hw_encoding" bson:"transcode_hw_encoding"`
+	Timestamp                 string           `json:"timestamp" bson:"timestamp"`
+	MediaServer               MediaServerEvent `json:"mediaServer" bson:"mediaServer"`
+	ServiceName               string           `json:"serviceName" bson:"serviceName"`
+	CreatedAt                 time.Time        `json:"createdAt" bson:"createdAt"`
+}
+
+// ToJSON converts the struct to JSON
+func (p *TautulliWebhookData) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct
+func (p *TautulliWebhookData) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts the HTTP request to struct
+func (p *TautulliWebhookData) FromHTTPRequest(r *http.Request) error {
+	err := json.NewDecoder(r.Body).Decode(p)
+	if err != nil {
+		return err
+	}
+	p.MediaServer = p.toMediaServerEvent()
+	p.ServiceName = "tautulli"
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p TautulliWebhookData) Envelope() EventEnvelope {
+	return mediaServerEnvelope(p.ServiceName, p.Action, p.MediaServer)
+}
+
+// toMediaServerEvent returns the fields that are shared with the other media servers.
+func (p *TautulliWebhookData) toMediaServerEvent() MediaServerEvent {
+	return MediaServerEvent{
+		User:        p.User,
+		Player:      p.Player,
+		ItemTitle:   p.Title,
+		ItemType:    normalizeItemType(p.MediaType),
+		SeriesTitle: p.ShowName,
+		ProviderIDs: ProviderIDs{
+			Tmdb: p.TheMovieDbID,
+			Tvdb: p.TheTvDbID,
+			Imdb: p.ImdbID,
+		},
+	}
+}
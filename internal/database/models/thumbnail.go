@@ -0,0 +1,58 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// ThumbnailsBucket is the name of the GridFS bucket for storing the thumbnails sent with webhooks, named by the
+	// SHA-256 hash of their contents.
+	ThumbnailsBucket = "thumbnails"
+)
+
+// StoreThumbnail stores the image in the thumbnails bucket unless it is already stored, and returns its hash. Each hash
+// is stored once, even when webhooks with the same thumbnail are processed at the same time.
+func StoreThumbnail(image []byte) (string, error) {
+	contentType := http.DetectContentType(image)
+	if !strings.HasPrefix(contentType, "image/") {
+		return "", fmt.Errorf("thumbnail is not an image: %s", contentType)
+	}
+
+	sum := sha256.Sum256(image)
+	hash := hex.EncodeToString(sum[:])
+
+	count, err := CountFilesInBucket(ThumbnailsBucket, bson.M{"filename": hash})
+	if err != nil {
+		return "", fmt.Errorf("could not look up thumbnail: %w", err)
+	}
+	if count > 0 {
+		return hash, nil
+	}
+
+	// The unique index on the file names rejects the thumbnail if a concurrent webhook stored it in the meantime, in
+	// which case the chunks that were already uploaded are removed again
+	id := primitive.NewObjectID()
+	err = AddFileToBucketWithID(ThumbnailsBucket, id, hash, image, bson.M{"contentType": contentType})
+	if mongo.IsDuplicateKeyError(err) {
+		DeleteFileFromBucket(ThumbnailsBucket, id)
+		return hash, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not store thumbnail: %w", err)
+	}
+	return hash, nil
+}
+
+// IsThumbnailHash returns true if the supplied string has the form of a thumbnail hash.
+func IsThumbnailHash(hash string) bool {
+	decoded, err := hex.DecodeString(hash)
+	return err == nil && len(decoded) == sha256.Size && strings.ToLower(hash) == hash
+}
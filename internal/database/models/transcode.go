@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TranscodeJobEvent is the struct that represents a finished job of a transcoder (Tdarr, Unmanic), posted using the
+// recommended JSON template from the README. File is the path as the transcoder sees it, Path is the same file with
+// the service's path mappings applied, so it can be matched against MovieFile.Path and EpisodeFile.Path.
+type TranscodeJobEvent struct {
+	Client        string       `json:"client" bson:"client"`
+	File          string       `json:"file" bson:"file"`
+	Path          string       `json:"path" bson:"path"`
+	OriginalCodec string       `json:"originalCodec" bson:"originalCodec"`
+	NewCodec      string       `json:"newCodec" bson:"newCodec"`
+	OriginalSize  FlexibleInt  `json:"originalSize" bson:"originalSize"`
+	NewSize       FlexibleInt  `json:"newSize" bson:"newSize"`
+	SpaceSaved    int64        `json:"spaceSaved" bson:"spaceSaved"`
+	Duration      FlexibleInt  `json:"duration" bson:"duration"`
+	Success       FlexibleBool `json:"success" bson:"success"`
+	Error         string       `json:"error,omitempty" bson:"error,omitempty"`
+	ServiceName   string       `json:"serviceName" bson:"serviceName"`
+	CreatedAt     time.Time    `json:"createdAt" bson:"createdAt"`
+}
+
+// ToJSON converts the struct to JSON
+func (p *TranscodeJobEvent) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct
+func (p *TranscodeJobEvent) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts the HTTP request of the given transcoder to struct
+func (p *TranscodeJobEvent) FromHTTPRequest(r *http.Request, client string) error {
+	err := json.NewDecoder(r.Body).Decode(p)
+	if err != nil {
+		return err
+	}
+	if p.File == "" {
+		return fmt.Errorf("missing file")
+	}
+
+	p.Path = p.File
+	if p.Success && p.OriginalSize > 0 && p.NewSize > 0 {
+		p.SpaceSaved = int64(p.OriginalSize - p.NewSize)
+	}
+
+	p.Client = client
+	p.ServiceName = client
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p TranscodeJobEvent) Envelope() EventEnvelope {
+	envelope := EventEnvelope{
+		Service:   p.ServiceName,
+		Category:  EventCategoryOther,
+		Action:    "transcoded",
+		EventType: "success",
+	}
+	if !p.Success {
+		envelope.Action, envelope.EventType = "transcode_failed", "failure"
+	}
+	return envelope
+}
+
+// MapPath sets Path to File with the longest matching prefix of the supplied mappings (transcoder path to Servarr
+// path) replaced.
+func (p *TranscodeJobEvent) MapPath(mappings map[string]string) {
+	longest := ""
+	for from := range mappings {
+		if strings.HasPrefix(p.File, from) && len(from) > len(longest) {
+			longest = from
+		}
+	}
+	if longest == "" {
+		p.Path = p.File
+		return
+	}
+
+	p.Path = mappings[longest] + strings.TrimPrefix(p.File, longest)
+}
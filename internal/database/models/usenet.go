@@ -0,0 +1,239 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// UsenetJobStatusCompleted is the status of a job that was downloaded and post-processed successfully
+	UsenetJobStatusCompleted = "Completed"
+	// UsenetJobStatusFailed is the status of a job that failed to download, verify, repair or unpack
+	UsenetJobStatusFailed = "Failed"
+)
+
+// UsenetJobEvent is the struct that represents a finished job posted by the post-processing script of a Usenet
+// client (SABnzbd, NZBGet). DownloadID matches the downloadId the Servarr applications report for the grab.
+type UsenetJobEvent struct {
+	Client       string    `json:"client" bson:"client"`
+	DownloadID   string    `json:"downloadId" bson:"downloadId"`
+	JobName      string    `json:"jobName" bson:"jobName"`
+	Category     string    `json:"category" bson:"category"`
+	Status       string    `json:"status" bson:"status"`
+	ClientStatus string    `json:"clientStatus" bson:"clientStatus"`
+	FailMessage  string    `json:"failMessage,omitempty" bson:"failMessage,omitempty"`
+	DownloadTime int64     `json:"downloadTime" bson:"downloadTime"`
+	Size         int64     `json:"size" bson:"size"`
+	Directory    string    `json:"directory" bson:"directory"`
+	ServiceName  string    `json:"serviceName" bson:"serviceName"`
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+
+	// unknownFields are the posted variables that aren't read, see UnknownFields
+	unknownFields map[string]interface{}
+}
+
+// usenetScriptVariables are the environment variables of the post-processing script of each client that are read.
+var usenetScriptVariables = map[string][]string{
+	"sabnzbd": {"SAB_NZO_ID", "SAB_FINAL_NAME", "SAB_FILENAME", "SAB_CAT", "SAB_COMPLETE_DIR", "SAB_FAIL_MSG", "SAB_PP_STATUS", "SAB_DOWNLOAD_TIME", "SAB_BYTES"},
+	"nzbget":  {"NZBPP_NZBID", "NZBPP_NZBNAME", "NZBPP_CATEGORY", "NZBPP_DIRECTORY", "NZBPP_STATUS", "NZBPP_TOTALSTATUS", "NZBPP_DOWNLOADTIME", "NZBPP_FILESIZELO", "NZBPP_FILESIZEHI"},
+}
+
+// UnknownFields returns the variables posted with the event that aren't read for the Usenet client, by name with the
+// value that was posted.
+func (p UsenetJobEvent) UnknownFields() map[string]interface{} {
+	return p.unknownFields
+}
+
+// ToJSON converts the struct to JSON
+func (p *UsenetJobEvent) ToJSON() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// FromJSON converts the JSON to struct
+func (p *UsenetJobEvent) FromJSON(data []byte) error {
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FromHTTPRequest converts the environment of the post-processing script of the given client to struct. The script
+// can post the SAB_* or NZBPP_* variables either as form fields or as a JSON object.
+func (p *UsenetJobEvent) FromHTTPRequest(r *http.Request, client string) error {
+	values, err := scriptValuesFromHTTPRequest(r)
+	if err != nil {
+		return err
+	}
+
+	switch client {
+	case "sabnzbd":
+		err = p.fromSABnzbd(values)
+	case "nzbget":
+		err = p.fromNZBGet(values)
+	default:
+		err = fmt.Errorf("unknown usenet client: %s", client)
+	}
+	if err != nil {
+		return err
+	}
+
+	if p.JobName == "" {
+		return fmt.Errorf("missing job name")
+	}
+
+	posted := url.Values{}
+	for name, value := range values {
+		posted.Set(name, value)
+	}
+	p.unknownFields = unknownScriptFields(posted, usenetScriptVariables[client])
+
+	p.Client = client
+	p.ServiceName = client
+	p.CreatedAt = time.Now()
+	return nil
+}
+
+// Envelope returns the normalized fields of the event, see EventEnvelope.
+func (p UsenetJobEvent) Envelope() EventEnvelope {
+	return EventEnvelope{
+		Service:   p.ServiceName,
+		Category:  EventCategoryDownload,
+		Action:    normalizeAction(p.Status),
+		EventType: p.Status,
+	}
+}
+
+// fromSABnzbd fills the struct from the SAB_* environment variables of a SABnzbd post-processing script.
+func (p *UsenetJobEvent) fromSABnzbd(values map[string]string) error {
+	var err error
+	p.DownloadID = values["SAB_NZO_ID"]
+	p.JobName = values["SAB_FINAL_NAME"]
+	if p.JobName == "" {
+		p.JobName = values["SAB_FILENAME"]
+	}
+	p.Category = values["SAB_CAT"]
+	p.Directory = values["SAB_COMPLETE_DIR"]
+	p.FailMessage = values["SAB_FAIL_MSG"]
+	p.ClientStatus = values["SAB_PP_STATUS"]
+
+	// SAB_PP_STATUS is 0 when everything went fine, and -1 (or a sum of the failed steps) otherwise
+	p.Status = UsenetJobStatusCompleted
+	if (p.ClientStatus != "" && p.ClientStatus != "0") || p.FailMessage != "" {
+		p.Status = UsenetJobStatusFailed
+	}
+
+	if p.DownloadTime, err = parseScriptInt(values, "SAB_DOWNLOAD_TIME"); err != nil {
+		return err
+	}
+	if p.Size, err = parseScriptInt(values, "SAB_BYTES"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// fromNZBGet fills the struct from the NZBPP_* environment variables of an NZBGet post-processing script.
+func (p *UsenetJobEvent) fromNZBGet(values map[string]string) error {
+	p.DownloadID = values["NZBPP_NZBID"]
+	p.JobName = values["NZBPP_NZBNAME"]
+	p.Category = values["NZBPP_CATEGORY"]
+	p.Directory = values["NZBPP_DIRECTORY"]
+	p.ClientStatus = values["NZBPP_STATUS"]
+
+	// NZBPP_STATUS is "<total status>/<detail>", such as "SUCCESS/ALL" or "FAILURE/UNPACK"
+	totalStatus, detail, _ := strings.Cut(p.ClientStatus, "/")
+	if totalStatus == "" {
+		totalStatus = values["NZBPP_TOTALSTATUS"]
+	}
+	p.Status = UsenetJobStatusCompleted
+	if totalStatus == "FAILURE" || totalStatus == "DELETED" {
+		p.Status = UsenetJobStatusFailed
+		p.FailMessage = strings.ToLower(detail)
+	}
+
+	downloadTime, err := parseScriptInt(values, "NZBPP_DOWNLOADTIME")
+	if err != nil {
+		return err
+	}
+	p.DownloadTime = downloadTime
+
+	// NZBGet splits the size into the low and high 32 bits
+	sizeLow, err := parseScriptInt(values, "NZBPP_FILESIZELO")
+	if err != nil {
+		return err
+	}
+	sizeHigh, err := parseScriptInt(values, "NZBPP_FILESIZEHI")
+	if err != nil {
+		return err
+	}
+	p.Size = sizeHigh<<32 | sizeLow
+	return nil
+}
+
+// scriptValuesFromHTTPRequest returns the variables posted by a script, either as a JSON object or as form fields.
+func scriptValuesFromHTTPRequest(r *http.Request) (map[string]string, error) {
+	values := map[string]string{}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+			return nil, err
+		}
+		for key := range r.PostForm {
+			values[key] = r.PostForm.Get(key)
+		}
+		return values, nil
+	}
+
+	raw := map[string]interface{}{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	for key, value := range raw {
+		if value != nil {
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
+
+// unknownScriptFields returns the posted values whose names aren't one of the known names, with the value that was
+// posted.
+func unknownScriptFields(posted url.Values, known []string) map[string]interface{} {
+	unknown := map[string]interface{}{}
+	for name := range posted {
+		isKnown := false
+		for _, k := range known {
+			if name == k {
+				isKnown = true
+				break
+			}
+		}
+		if !isKnown {
+			unknown[name] = posted.Get(name)
+		}
+	}
+	return unknown
+}
+
+// parseScriptInt parses the integer variable with the given name, which is zero when it wasn't posted.
+func parseScriptInt(values map[string]string, name string) (int64, error) {
+	value := strings.TrimSpace(values[name])
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
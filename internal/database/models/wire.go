@@ -0,0 +1,247 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"plex_monitor/internal/database"
+	"plex_monitor/internal/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNoRawWire is the error that is returned when a stored event doesn't link to a raw request wire.
+var ErrNoRawWire = errors.New("event has no raw wire")
+
+const (
+	// RawWireParsed is the parse status of raw wires whose events were stored
+	RawWireParsed = "parsed"
+	// RawWireFailed is the parse status of raw wires that could not be parsed or stored
+	RawWireFailed = "failed"
+	// RawWireDuplicate is the parse status of raw wires that were not stored again because they are duplicates
+	RawWireDuplicate = "duplicate"
+
+	// wireRetentionConfigKey is the service config key of the raw wire retention policy
+	wireRetentionConfigKey = "wireRetention"
+)
+
+// StoreRawWire stores the raw HTTP request in the raw request wires bucket and returns its unique ID. The SHA-256 hash
+// of the request is stored in the metadata, so identical requests can be found. Every received request gets its own
+// wire, so duplicates are kept as they arrived.
+func StoreRawWire(serviceType string, wire []byte, receivedAt time.Time, metadata bson.M) (primitive.ObjectID, error) {
+	id := primitive.NewObjectID()
+	sum := sha256.Sum256(wire)
+
+	if metadata == nil {
+		metadata = bson.M{}
+	}
+	metadata["sha256"] = hex.EncodeToString(sum[:])
+
+	filename := fmt.Sprintf("%s_%s_%s.txt", serviceType, receivedAt.Format("2006-01-02_15:04:05"), id.Hex())
+	err := AddFileToBucketWithID(RawRequestWiresBucket, id, filename, wire, metadata)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("could not store raw wire: %w", err)
+	}
+	return id, nil
+}
+
+// StoreUnredactedRawWire stores the raw HTTP request as it was received, before secrets were redacted from it (see
+// StoreRawWire), encrypted with the supplied key. It is stored under the ID of the redacted wire.
+func StoreUnredactedRawWire(id primitive.ObjectID, wire []byte, key []byte) error {
+	// Compress before encrypting, as the ciphertext doesn't compress
+	compressed, err := gzipFile(wire)
+	if err != nil {
+		return err
+	}
+	encrypted, err := utils.Encrypt(key, compressed)
+	if err != nil {
+		return fmt.Errorf("could not encrypt raw wire: %w", err)
+	}
+
+	err = AddFileToBucketWithID(UnredactedRawWiresBucket, id, id.Hex()+".bin", encrypted, bson.M{"encryption": "aes-gcm"})
+	if err != nil {
+		return fmt.Errorf("could not store unredacted raw wire: %w", err)
+	}
+	return nil
+}
+
+// GetUnredactedRawWire returns the raw HTTP request with the supplied ID as it was received, decrypted with the key it
+// was stored with.
+func GetUnredactedRawWire(id primitive.ObjectID, key []byte) ([]byte, error) {
+	encrypted, err := GetFileFromBucketByID(UnredactedRawWiresBucket, id)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed, err := utils.Decrypt(key, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt raw wire: %w", err)
+	}
+	return decompressFile(compressed, gzipCompression)
+}
+
+// GetRawWire returns the raw HTTP request with the supplied ID.
+func GetRawWire(id primitive.ObjectID) ([]byte, error) {
+	return GetFileFromBucketByID(RawRequestWiresBucket, id)
+}
+
+// GetRawWireIDForEvent returns the ID of the raw HTTP request the stored event was parsed from.
+func GetRawWireIDForEvent(eventID primitive.ObjectID) (primitive.ObjectID, error) {
+	var event struct {
+		RawWireID *primitive.ObjectID `bson:"rawWireId"`
+	}
+
+	opts := options.FindOne().SetProjection(bson.M{"rawWireId": 1})
+	err := database.DB.Collection(database.WebhookCollectionName).FindOne(context.Background(), bson.M{"_id": eventID}, opts).Decode(&event)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if event.RawWireID == nil {
+		return primitive.NilObjectID, ErrNoRawWire
+	}
+	return *event.RawWireID, nil
+}
+
+// SetRawWireParseStatus records whether the events of the raw wire were stored, along with the error if they weren't.
+func SetRawWireParseStatus(id primitive.ObjectID, status string, parseErr error) error {
+	bucket, err := createBucket(RawRequestWiresBucket)
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{"metadata.parseStatus": status}
+	if parseErr != nil {
+		set["metadata.parseError"] = parseErr.Error()
+	}
+	_, err = bucket.GetFilesCollection().UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("could not set raw wire parse status: %w", err)
+	}
+	return nil
+}
+
+// WireRetentionPolicy is how long the raw wires of a service are kept, configured as the wireRetention object of the
+// service config (e.g. {"days": 30, "failedOnly": true}).
+type WireRetentionPolicy struct {
+	// Days is the number of days the wires are kept, zero keeps them forever
+	Days int
+	// FailedOnly removes the wires of webhooks that were stored as soon as possible, so only the failed ones are kept
+	FailedOnly bool
+}
+
+// WireRetentionPolicy returns the raw wire retention policy of the service, and false if the wires are kept forever.
+func (s ServiceData) WireRetentionPolicy() (WireRetentionPolicy, bool) {
+	config := s.ConfigMap(wireRetentionConfigKey)
+
+	policy := WireRetentionPolicy{}
+	switch days := config["days"].(type) {
+	case int:
+		policy.Days = days
+	case int32:
+		policy.Days = int(days)
+	case int64:
+		policy.Days = int(days)
+	case float64:
+		policy.Days = int(days)
+	}
+	policy.FailedOnly, _ = config["failedOnly"].(bool)
+
+	return policy, policy.Days > 0 || policy.FailedOnly
+}
+
+// SweepRawWires removes the raw wires of the service that the retention policy no longer keeps, and returns the
+// number of wires that were removed.
+func SweepRawWires(serviceID string, policy WireRetentionPolicy, now time.Time) (int, error) {
+	expired := bson.A{}
+	if policy.Days > 0 {
+		expired = append(expired, bson.M{"uploadDate": bson.M{"$lt": now.AddDate(0, 0, -policy.Days)}})
+	}
+	if policy.FailedOnly {
+		expired = append(expired, bson.M{"metadata.parseStatus": bson.M{"$in": bson.A{RawWireParsed, RawWireDuplicate}}})
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	bucket, err := createBucket(RawRequestWiresBucket)
+	if err != nil {
+		return 0, err
+	}
+
+	filter := bson.M{"metadata.serviceId": serviceID, "$or": expired}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := bucket.GetFilesCollection().Find(context.Background(), filter, opts)
+	if err != nil {
+		return 0, fmt.Errorf("could not find expired raw wires: %w", err)
+	}
+
+	files := []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}{}
+	err = cursor.All(context.Background(), &files)
+	if err != nil {
+		return 0, fmt.Errorf("could not find expired raw wires: %w", err)
+	}
+
+	removed := 0
+	for _, file := range files {
+		err = bucket.Delete(file.ID)
+		if err != nil {
+			return removed, fmt.Errorf("could not remove raw wire %s: %w", file.ID.Hex(), err)
+		}
+		removed++
+
+		// Remove the unredacted copy along with it, if there is one
+		err = DeleteFileFromBucket(UnredactedRawWiresBucket, file.ID)
+		if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return removed, fmt.Errorf("could not remove unredacted raw wire %s: %w", file.ID.Hex(), err)
+		}
+	}
+	return removed, nil
+}
+
+// RawWireUsage is the storage used by the raw wires of a service type.
+type RawWireUsage struct {
+	Service string `bson:"_id"`
+	Files   int64  `bson:"files"`
+	// StoredSize is the size of the wires as stored, after compression
+	StoredSize int64 `bson:"storedSize"`
+	// Size is the size of the wires before compression
+	Size int64 `bson:"size"`
+}
+
+// GetRawWireUsage returns the storage used by the raw wires per service type, largest first.
+func GetRawWireUsage() ([]RawWireUsage, error) {
+	bucket, err := createBucket(RawRequestWiresBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$metadata.service",
+			"files":      bson.M{"$sum": 1},
+			"storedSize": bson.M{"$sum": "$length"},
+			"size":       bson.M{"$sum": bson.M{"$ifNull": bson.A{"$metadata.uncompressedSize", "$length"}}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"storedSize": -1}}},
+	}
+	cursor, err := bucket.GetFilesCollection().Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := []RawWireUsage{}
+	err = cursor.All(context.Background(), &usage)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
@@ -23,6 +25,8 @@ var (
 	ErrInvalidHash = errors.New("the encoded hash is not in the correct format")
 	// ErrIncompatibleVersion is the error that is returned when the encoded hash was created with a different version of argon2.
 	ErrIncompatibleVersion = errors.New("incompatible version of argon2")
+	// ErrInvalidCiphertext is the error that is returned when the data to decrypt is too short to have been encrypted.
+	ErrInvalidCiphertext = errors.New("the ciphertext is not in the correct format")
 )
 
 type argonParams struct {
@@ -58,6 +62,71 @@ func CompareStringToHash(suppliedString string, hashedString string) bool {
 	return match
 }
 
+// GenerateRandomKey returns a random, URL-safe key that can be handed out to clients.
+func GenerateRandomKey() (string, error) {
+	b, err := generateRandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseEncryptionKey decodes the base64 encoded AES key, which must be 16, 24 or 32 bytes long.
+func ParseEncryptionKey(encodedKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("the key is not base64 encoded: %w", err)
+	}
+
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("the key must be 16, 24 or 32 bytes long, not %d", len(key))
+	}
+}
+
+// Encrypt encrypts the plaintext with AES-GCM using the supplied 16, 24 or 32 byte key. The random nonce is prepended
+// to the returned ciphertext.
+func Encrypt(key []byte, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := generateRandomBytes(uint32(gcm.NonceSize()))
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt decrypts the ciphertext returned by Encrypt with the same key.
+func Decrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
 func generateRandomBytes(n uint32) ([]byte, error) {
 	b := make([]byte, n)
 	_, err := rand.Read(b)
@@ -2,17 +2,23 @@ package firehose
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"plex_monitor/internal/database"
+	"plex_monitor/internal/database/models"
 	"plex_monitor/internal/web/api/controllers/webhook"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func setup() {
@@ -31,15 +37,37 @@ func teardown() {
 	database.CloseDB()
 }
 
+const testServiceKey = "test-service-key"
+
+// createTestService registers a service of the given type that accepts testServiceKey.
+func createTestService(t *testing.T, serviceType string) {
+	key, err := models.HashServiceKey(testServiceKey)
+	assert.NoError(t, err)
+
+	_, err = database.DB.Collection(database.ServicesCollectionName).InsertOne(database.Ctx, models.ServiceData{
+		ID:          serviceType,
+		ServiceName: serviceType,
+		ServiceType: serviceType,
+		Keys:        []models.ServiceKey{key},
+		CreatedAt:   time.Now(),
+		CreatedBy:   models.SystemUserID,
+		UpdatedAt:   time.Now(),
+		UpdatedBy:   models.SystemUserID,
+	})
+	assert.NoError(t, err)
+}
+
 func TestFirehose(t *testing.T) {
 	setup()
 	defer teardown()
+	createTestService(t, "sonarr")
+	createTestService(t, "radarr")
 
 	// BEGIN DATA SEEDING
 	// Create a request to pass to our
 	// handler. We don't have any query parameters for now, so we'll
 	// pass 'nil' as the third parameter.
-	req, err := http.NewRequest("POST", "/webhook?service=sonarr", nil)
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr&key="+testServiceKey, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -88,7 +116,7 @@ func TestFirehose(t *testing.T) {
 	assert.Contains(t, rr.Body.String(), `/tv/tv/Doctor Who (1963)`, "Did not find expected string in response body")
 
 	// BEGIN DATA SEEDING AGAIN
-	req, err = http.NewRequest("POST", "/webhook?service=radarr", nil)
+	req, err = http.NewRequest("POST", "/webhook?service=radarr&key="+testServiceKey, nil)
 	assert.NoError(t, err, "Creating radarr seed request should not error")
 
 	// Load json file and add it to the request body
@@ -133,3 +161,45 @@ func TestFirehose(t *testing.T) {
 	radarrIndex := strings.Index(rr.Body.String(), "radarr")
 	assert.Greater(t, radarrIndex, sonnarIndex, "The ordering was incorrect on the response data")
 }
+
+func TestFirehoseRawWire(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sonarr")
+
+	contents, err := os.ReadFile("../../../../../test/sonarr_webhook_response_sample__on_grab.json")
+	assert.NoError(t, err)
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr&key="+testServiceKey, bytes.NewReader(contents))
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(webhook.Entry).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Jump from the stored event to the request it was parsed from
+	event := bson.M{}
+	err = database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, bson.M{"service": "sonarr"}).Decode(&event)
+	assert.NoError(t, err)
+	assert.Contains(t, event, "rawWireId")
+	assert.Equal(t, models.EventCategoryGrab, event["category"])
+
+	rr = getRawWire(event["_id"].(primitive.ObjectID).Hex())
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Body.String(), "POST /webhook?service=sonarr"))
+	assert.Contains(t, rr.Body.String(), `/tv/tv/Doctor Who (1963)`)
+
+	// Unknown events are not found
+	assert.Equal(t, http.StatusNotFound, getRawWire(primitive.NewObjectID().Hex()).Code)
+	assert.Equal(t, http.StatusBadRequest, getRawWire("not-an-id").Code)
+}
+
+// getRawWire requests the raw request of the firehose entry with the supplied ID.
+func getRawWire(id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/firehose/"+id+"/wire", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(RawWire).ServeHTTP(rr, req)
+	return rr
+}
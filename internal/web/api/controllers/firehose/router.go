@@ -29,6 +29,7 @@ func Routes() *chi.Mux {
 
 		// Private endpoints
 		r.Get("/", Firehose)
+		r.Get("/{id}/wire", RawWire)
 	})
 
 	return router
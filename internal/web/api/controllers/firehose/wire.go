@@ -0,0 +1,54 @@
+package firehose
+
+import (
+	"errors"
+	"net/http"
+	"plex_monitor/internal/database/models"
+	"plex_monitor/internal/web/api"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// RawWire is the endpoint that returns the raw HTTP request a firehose entry was parsed from.
+func RawWire(w http.ResponseWriter, r *http.Request) {
+	l := logrus.WithFields(logrus.Fields{
+		"endpoint": r.URL.Path,
+		"id":       chi.URLParam(r, "id"),
+	})
+
+	eventID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		api.RenderError("Invalid event ID", l, w, r, err)
+		return
+	}
+
+	rawWireID, err := models.GetRawWireIDForEvent(eventID)
+	if err != nil {
+		renderRawWireError(l, w, r, err)
+		return
+	}
+	l = l.WithField("rawWireId", rawWireID.Hex())
+
+	wire, err := models.GetRawWire(rawWireID)
+	if err != nil {
+		renderRawWireError(l, w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(wire)
+}
+
+// renderRawWireError renders a not found response if the event or its raw request doesn't exist, and an internal
+// error otherwise.
+func renderRawWireError(l *logrus.Entry, w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, models.ErrNoRawWire) || errors.Is(err, gridfs.ErrFileNotFound) {
+		api.RenderErrorWithStatus(http.StatusNotFound, "Raw request not found", l, w, r, err)
+		return
+	}
+	api.RenderErrorWithStatus(http.StatusInternalServerError, "Unable to load raw request", l, w, r, err)
+}
@@ -0,0 +1,26 @@
+package thumbnail
+
+import (
+	"os"
+	"plex_monitor/internal/web/middleware"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/jwtauth"
+)
+
+// Routes returns the router for the thumbnail endpoints
+func Routes() *chi.Mux {
+	router := chi.NewRouter()
+	tokenAuth := jwtauth.New("HS256", []byte(os.Getenv("SECRET_KEY")), nil)
+
+	// Protected endpoints
+	router.Group(func(r chi.Router) {
+		r.Use(jwtauth.Verifier(tokenAuth))
+		r.Use(jwtauth.Authenticator)
+		r.Use(middleware.CreateUserContext)
+
+		r.Get("/{hash}", Thumbnail)
+	})
+
+	return router
+}
@@ -0,0 +1,44 @@
+package thumbnail
+
+import (
+	"errors"
+	"net/http"
+	"plex_monitor/internal/database/models"
+	"plex_monitor/internal/web/api"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// Thumbnail is the endpoint that returns a thumbnail sent with a webhook, by the hash stored on the event.
+func Thumbnail(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+	l := logrus.WithFields(logrus.Fields{
+		"endpoint": r.URL.Path,
+		"hash":     hash,
+	})
+
+	if !models.IsThumbnailHash(hash) {
+		api.RenderError("Invalid thumbnail hash", l, w, r, nil)
+		return
+	}
+
+	image, err := models.GetFileFromBucket(models.ThumbnailsBucket, hash)
+	if err != nil {
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			api.RenderErrorWithStatus(http.StatusNotFound, "Thumbnail not found", l, w, r, nil)
+			return
+		}
+		api.RenderErrorWithStatus(http.StatusInternalServerError, "Unable to load thumbnail", l, w, r, err)
+		return
+	}
+
+	// Thumbnails are addressed by their contents, so they never change
+	w.Header().Set("Content-Type", http.DetectContentType(image))
+	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Write(image)
+}
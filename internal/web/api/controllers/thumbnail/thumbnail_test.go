@@ -0,0 +1,93 @@
+package thumbnail
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"plex_monitor/internal/database"
+	"plex_monitor/internal/database/models"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func setup() {
+	// Init logging
+	logrus.SetReportCaller(true)
+	logrus.SetLevel(logrus.DebugLevel)
+	// Initialize the database
+	database.InitDB(os.Getenv("DATABASE_URL"), "plex_monitor_test")
+}
+
+func teardown() {
+	// Drop the database
+	database.DB.Drop(database.Ctx)
+
+	// Close the database connection
+	database.CloseDB()
+}
+
+// getThumbnail requests the thumbnail with the supplied hash.
+func getThumbnail(hash string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/"+hash, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("hash", hash)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Thumbnail)
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestThumbnail(t *testing.T) {
+	setup()
+	defer teardown()
+
+	thumb := append([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), make([]byte, 64)...)
+	hash, err := models.StoreThumbnail(thumb)
+	assert.NoError(t, err)
+
+	rr := getThumbnail(hash)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"))
+	assert.Equal(t, thumb, rr.Body.Bytes())
+
+	// Unknown and malformed hashes are rejected
+	assert.Equal(t, http.StatusNotFound, getThumbnail(strings.Repeat("0", 64)).Code)
+	assert.Equal(t, http.StatusBadRequest, getThumbnail("../raw_request_wires").Code)
+}
+
+func TestStoreThumbnailRejectsNonImages(t *testing.T) {
+	_, err := models.StoreThumbnail([]byte("<html></html>"))
+	assert.Error(t, err)
+}
+
+func TestStoreThumbnailConcurrently(t *testing.T) {
+	setup()
+	defer teardown()
+
+	thumb := append([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), make([]byte, 64)...)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := models.StoreThumbnail(thumb)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// Assert that the thumbnail was stored once
+	count, err := models.CountFilesInBucket(models.ThumbnailsBucket, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
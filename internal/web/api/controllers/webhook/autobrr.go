@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryAutobrrWebhook is the name of the repository for the Autobrr webhook
+	RepositoryAutobrrWebhook = "autobrr"
+)
+
+func init() {
+	Register(RepositoryAutobrrWebhook, AutobrrMonitoringService{},
+		models.AutobrrActionResultMatched, "PUSH_APPROVED", "PUSH_REJECTED", "PUSH_ERROR",
+	)
+}
+
+// AutobrrMonitoringService is the struct for the Autobrr webhook
+type AutobrrMonitoringService struct{}
+
+// AutobrrWebhook parses the Autobrr release and stores it, so it can be followed to the Servarr grab by release title.
+func (ams AutobrrMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Info("Firing webhook for Autobrr")
+
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	autobrrWebhookData := models.AutobrrWebhookData{}
+	err = autobrrWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryAutobrrWebhook, autobrrWebhookData.Envelope().EventType, body, autobrrWebhookData)
+
+	return StoreEvent(r, autobrrWebhookData)
+}
+
+// LegacyEvent returns the model the autobrr events were stored as before events were stored in envelopes.
+func (ams AutobrrMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.AutobrrWebhookData{}
+}
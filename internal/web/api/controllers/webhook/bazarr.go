@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryBazarrWebhook is the name of the repository for the Bazarr webhook
+	RepositoryBazarrWebhook = "bazarr"
+)
+
+func init() {
+	Register(RepositoryBazarrWebhook, BazarrMonitoringService{},
+		"downloaded", "upgraded", "manually downloaded", models.BazarrActionNotFound,
+	)
+}
+
+// BazarrMonitoringService is the struct for the Bazarr webhook
+type BazarrMonitoringService struct{}
+
+// BazarrWebhook parses the Bazarr notification and links it to the Sonarr/Radarr media it is about.
+func (bms BazarrMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Info("Firing webhook for Bazarr")
+
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	bazarrWebhookData := models.BazarrWebhookData{}
+	err = bazarrWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryBazarrWebhook, bazarrWebhookData.Envelope().EventType, body, bazarrWebhookData)
+
+	// Not being able to link the subtitles shouldn't drop the event
+	err = bazarrWebhookData.ResolveServarrIDs()
+	if err != nil {
+		l.WithError(err).Warn("Could not look up Sonarr/Radarr IDs for Bazarr event")
+	}
+
+	return StoreEvent(r, bazarrWebhookData)
+}
+
+// LegacyEvent returns the model the Bazarr events were stored as before events were stored in envelopes.
+func (bms BazarrMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.BazarrWebhookData{}
+}
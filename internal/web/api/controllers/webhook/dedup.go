@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"plex_monitor/internal/database/models"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader is the header that can be used to supply a key identifying the webhook, so retries of the
+	// same webhook are only stored once
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// ReplayHeader is the header pm-cli sets on the requests it replays, which are stored even if they are
+	// duplicates
+	ReplayHeader = "X-Webhook-Replay"
+
+	// DefaultDedupWindow is the time within which a webhook with the same payload is considered a duplicate
+	DefaultDedupWindow = time.Minute
+	// IdempotencyKeyWindow is the time within which a webhook with the same idempotency key is considered a duplicate
+	IdempotencyKeyWindow = 24 * time.Hour
+)
+
+// DedupWindow is the time within which a webhook with the same payload for the same service is considered a
+// duplicate. Setting it to zero disables the payload check, the Idempotency-Key header is still honoured.
+var DedupWindow = DefaultDedupWindow
+
+// claimWebhook checks that the webhook wasn't stored before and claims it, so that duplicates received later are not
+// stored. It returns the claim, which is nil if the webhook is not deduplicated, and false if the webhook is a
+// duplicate. The claim is committed once the webhook was stored, or released if it couldn't be. Replayed requests
+// (see ReplayHeader) are not deduplicated.
+func claimWebhook(r *http.Request) (*models.DedupClaim, bool, error) {
+	service, ok := ServiceFromContext(r.Context())
+	if !ok || r.Header.Get(ReplayHeader) != "" {
+		return nil, true, nil
+	}
+
+	h := sha256.New()
+	io.WriteString(h, service.ID+"\x00")
+
+	window := IdempotencyKeyWindow
+	idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+	if idempotencyKey != "" {
+		io.WriteString(h, "idempotency\x00"+idempotencyKey)
+	} else {
+		if DedupWindow <= 0 {
+			return nil, true, nil
+		}
+		window = DedupWindow
+
+		payload, err := normalizedPayload(r)
+		if err != nil {
+			return nil, true, err
+		}
+		io.WriteString(h, "payload\x00"+r.URL.Query().Get("event")+"\x00")
+		h.Write(payload)
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	at := receivedAt(r)
+	claim := &models.DedupClaim{
+		Hash:           hash,
+		ServiceID:      service.ID,
+		IdempotencyKey: idempotencyKey,
+		ExpiresAt:      at.Add(window),
+		CreatedAt:      at,
+	}
+	claimed, err := claim.Claim()
+	if err != nil {
+		return nil, true, err
+	}
+	return claim, claimed, nil
+}
+
+// normalizedPayload returns the request body in a form that doesn't depend on the order of the JSON keys or form
+// fields. Uploaded files, like the Plex thumbnail, are left out.
+func normalizedPayload(r *http.Request) ([]byte, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body, nil
+		}
+		return []byte(normalizedForm(form).Encode()), nil
+	case "multipart/form-data":
+		form := url.Values{}
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return body, nil
+			}
+			if part.FileName() != "" {
+				continue
+			}
+			value, err := io.ReadAll(part)
+			if err != nil {
+				return body, nil
+			}
+			form.Add(part.FormName(), string(value))
+		}
+		return []byte(normalizedForm(form).Encode()), nil
+	default:
+		return normalizedJSON(body), nil
+	}
+}
+
+// normalizedForm normalizes the JSON values of the form, such as the Plex payload.
+func normalizedForm(form url.Values) url.Values {
+	for name, values := range form {
+		for i := range values {
+			values[i] = string(normalizedJSON([]byte(values[i])))
+		}
+		form[name] = values
+	}
+	return form
+}
+
+// normalizedJSON re-encodes the JSON document with sorted keys and without whitespace, or returns the data as is if
+// it isn't JSON.
+func normalizedJSON(data []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return data
+	}
+	normalized, err := json.Marshal(value)
+	if err != nil {
+		return data
+	}
+	return normalized
+}
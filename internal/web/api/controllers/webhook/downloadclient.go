@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryDelugeWebhook is the name of the repository for the Deluge completion script
+	RepositoryDelugeWebhook = "deluge"
+	// RepositoryTransmissionWebhook is the name of the repository for the Transmission completion script
+	RepositoryTransmissionWebhook = "transmission"
+	// RepositoryQBittorrentWebhook is the name of the repository for the qBittorrent completion script
+	RepositoryQBittorrentWebhook = "qbittorrent"
+)
+
+func init() {
+	for _, client := range []string{RepositoryDelugeWebhook, RepositoryTransmissionWebhook, RepositoryQBittorrentWebhook} {
+		Register(client, DownloadClientMonitoringService{client: client}, "complete")
+	}
+}
+
+// DownloadClientMonitoringService is the struct for the download client completion scripts, which are all normalized
+// into a DownloadClientEvent
+type DownloadClientMonitoringService struct {
+	client string
+}
+
+// DownloadClientWebhook parses the completion script form of the download client and stores the finished download.
+func (dms DownloadClientMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Infof("Firing webhook for %s", dms.client)
+
+	downloadClientEvent := models.DownloadClientEvent{}
+	err := downloadClientEvent.FromHTTPRequest(r, dms.client)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	// Keep track of the form fields the client doesn't read
+	recordUnknownFields(l, r, dms.client, downloadClientEvent.Envelope().EventType, downloadClientEvent.UnknownFields())
+
+	return StoreEvent(r, downloadClientEvent)
+}
+
+// LegacyEvent returns the model the download client events were stored as before events were stored in envelopes.
+func (dms DownloadClientMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.DownloadClientEvent{}
+}
@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"net/http"
+	"plex_monitor/internal/database/models"
+	"plex_monitor/internal/web/api"
+
+	"github.com/go-chi/render"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// recordSchemaDrift records the fields of the body that the model doesn't decode, so we notice when a service starts
+// sending data the models don't know about yet. Failures are logged rather than returned so the event is still stored.
+func recordSchemaDrift(l *logrus.Entry, r *http.Request, serviceName string, eventType string, body []byte, model interface{}) {
+	// The examples of the fields are stored, so the secrets in them are redacted like in the raw requests
+	if redacted, ok := Redaction.redactJSON(body); ok {
+		body = redacted
+	}
+
+	unknown, err := models.UnknownJSONFields(body, model)
+	if err != nil {
+		l.WithError(err).Warn("Could not check webhook for schema drift")
+		return
+	}
+
+	recordUnknownFields(l, r, serviceName, eventType, unknown)
+}
+
+// recordUnknownFields records the fields that were sent but not decoded as schema drift, such as the form fields of
+// the download clients that the models don't read. The examples are redacted like the form fields of the raw requests.
+func recordUnknownFields(l *logrus.Entry, r *http.Request, serviceName string, eventType string, unknown map[string]interface{}) {
+	fields := make(map[string]interface{}, len(unknown))
+	for field, example := range unknown {
+		l.WithFields(logrus.Fields{"eventType": eventType, "field": field}).Debug("Webhook contains unknown field")
+		fields[field] = Redaction.redactField(field, example)
+	}
+
+	err := models.RecordSchemaDrift(serviceName, eventType, fields, receivedAt(r))
+	if err != nil {
+		l.WithError(err).Warn("Could not record schema drift")
+	}
+}
+
+// ListSchemaDrift is the endpoint that lists the fields services sent that the models don't decode, optionally
+// filtered by the service and event type query parameters.
+func ListSchemaDrift(w http.ResponseWriter, r *http.Request) {
+	l := logrus.WithFields(logrus.Fields{
+		"endpoint": r.URL.Path,
+	})
+
+	filter := bson.M{}
+	if service := r.URL.Query().Get("service"); service != "" {
+		filter["serviceName"] = service
+	}
+	if eventType := r.URL.Query().Get("eventType"); eventType != "" {
+		filter["eventType"] = eventType
+	}
+
+	drift, err := models.GetSchemaDrift(filter)
+	if err != nil {
+		api.RenderErrorWithStatus(http.StatusInternalServerError, "Unable to load schema drift", l, w, r, err)
+		return
+	}
+	render.JSON(w, r, map[string][]models.SchemaDrift{"data": drift})
+}
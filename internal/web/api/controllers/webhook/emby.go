@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryEmbyWebhook is the name of the repository for the Emby webhook
+	RepositoryEmbyWebhook = "emby"
+)
+
+func init() {
+	Register(RepositoryEmbyWebhook, EmbyMonitoringService{},
+		"playback.start", "playback.pause", "playback.unpause", "playback.stop", "library.new", "item.rate",
+		"user.authenticated", "user.authenticationfailed", "system.updateavailable", "system.serverrestartrequired",
+	)
+}
+
+// EmbyMonitoringService is the struct for the Emby webhook
+type EmbyMonitoringService struct{}
+
+// EmbyWebhook parses the Emby webhook and stores it next to the Plex events.
+func (ems EmbyMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Info("Firing webhook for Emby")
+
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	embyWebhookData := models.EmbyWebhookData{}
+	err = embyWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	// Keep track of the fields the model doesn't know about yet, multipart requests carry the JSON in a form field
+	if r.MultipartForm != nil {
+		body = []byte(r.FormValue("data"))
+	}
+	recordSchemaDrift(l, r, RepositoryEmbyWebhook, embyWebhookData.Event, body, embyWebhookData)
+
+	return StoreEvent(r, embyWebhookData)
+}
+
+// LegacyEvent returns the model the Emby events were stored as before events were stored in envelopes.
+func (ems EmbyMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.EmbyWebhookData{}
+}
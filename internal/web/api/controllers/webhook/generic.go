@@ -0,0 +1,57 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryGenericWebhook is the name of the repository for the generic JSON webhook
+	RepositoryGenericWebhook = "generic"
+
+	// mappingsConfigKey is the key of the service config that holds the field mappings of the generic webhook
+	mappingsConfigKey = "mappings"
+)
+
+func init() {
+	// The event types depend on the field mappings of each service
+	Register(RepositoryGenericWebhook, GenericMonitoringService{})
+}
+
+// GenericMonitoringService is the struct for the generic JSON webhook, which is normalized using the field mappings
+// from the config of the service the key belongs to
+type GenericMonitoringService struct{}
+
+// GenericWebhook parses the JSON payload, applies the field mappings of the service and stores it.
+func (gms GenericMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Info("Firing webhook for generic JSON")
+
+	genericWebhookData := models.GenericWebhookData{}
+	err := genericWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	service, ok := ServiceFromContext(r.Context())
+	if !ok {
+		// Retrying won't add the service to the request
+		return fmt.Errorf("no service found for the generic webhook: %w", errSpoolPermanent)
+	}
+	genericWebhookData.ServiceID = service.ID
+	genericWebhookData.Source = service.ServiceName
+
+	err = genericWebhookData.ApplyMappings(service.ConfigStringMap(mappingsConfigKey))
+	if err != nil {
+		return fmt.Errorf("could not map data (%w): %w", ErrBadRequestData, err)
+	}
+
+	return StoreEvent(r, genericWebhookData)
+}
+
+// LegacyEvent returns the model the generic webhook events were stored as before events were stored in envelopes.
+func (gms GenericMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.GenericWebhookData{}
+}
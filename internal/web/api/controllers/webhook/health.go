@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"net/http"
+	"plex_monitor/internal/database/models"
+	"plex_monitor/internal/web/api"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// defaultHealthIssuesLimit is the number of health issues listed when no limit is requested
+const defaultHealthIssuesLimit = 100
+
+// ListHealthIssues is the endpoint that lists the health issues of the Servarr applications, most recently opened
+// first. The status query parameter selects the open or closed issues, and the service, instance and type query
+// parameters filter them.
+func ListHealthIssues(w http.ResponseWriter, r *http.Request) {
+	l := logrus.WithFields(logrus.Fields{
+		"endpoint": r.URL.Path,
+	})
+
+	filter := bson.M{}
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+	case "open":
+		filter["open"] = true
+	case "closed":
+		filter["open"] = false
+	default:
+		api.RenderErrorWithStatus(http.StatusBadRequest, "Invalid status, expected open or closed", l, w, r, nil)
+		return
+	}
+	if service := r.URL.Query().Get("service"); service != "" {
+		filter["serviceName"] = service
+	}
+	if instance := r.URL.Query().Get("instance"); instance != "" {
+		filter["instance"] = instance
+	}
+	if issueType := r.URL.Query().Get("type"); issueType != "" {
+		filter["type"] = issueType
+	}
+
+	var limit int64 = defaultHealthIssuesLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			api.RenderErrorWithStatus(http.StatusBadRequest, "Invalid limit", l, w, r, err)
+			return
+		}
+		limit = parsed
+	}
+
+	issues, err := models.GetHealthIssues(filter, limit)
+	if err != nil {
+		api.RenderErrorWithStatus(http.StatusInternalServerError, "Unable to load health issues", l, w, r, err)
+		return
+	}
+
+	now := time.Now()
+	for i := range issues {
+		issues[i] = issues[i].WithDuration(now)
+	}
+	render.JSON(w, r, map[string][]models.HealthIssue{"data": issues})
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryJellyfinWebhook is the name of the repository for the Jellyfin webhook
+	RepositoryJellyfinWebhook = "jellyfin"
+)
+
+func init() {
+	Register(RepositoryJellyfinWebhook, JellyfinMonitoringService{},
+		"ItemAdded", "PlaybackStart", "PlaybackProgress", "PlaybackStop", "SessionStart", "UserCreated",
+		"AuthenticationSuccess", "AuthenticationFailure", "Generic",
+	)
+}
+
+// JellyfinMonitoringService is the struct for the Jellyfin webhook
+type JellyfinMonitoringService struct{}
+
+// JellyfinWebhook parses the Jellyfin Webhook plugin payload and stores it next to the Plex events.
+func (jms JellyfinMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Info("Firing webhook for Jellyfin")
+
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	jellyfinWebhookData := models.JellyfinWebhookData{}
+	err = jellyfinWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryJellyfinWebhook, jellyfinWebhookData.Envelope().EventType, body, jellyfinWebhookData)
+
+	return StoreEvent(r, jellyfinWebhookData)
+}
+
+// LegacyEvent returns the model the Jellyfin events were stored as before events were stored in envelopes.
+func (jms JellyfinMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.JellyfinWebhookData{}
+}
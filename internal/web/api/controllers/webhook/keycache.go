@@ -0,0 +1,42 @@
+package webhook
+
+import (
+	"errors"
+	"plex_monitor/internal/database/models"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// serviceCache holds the services whose keys were validated, so requests can still be authenticated (and spooled)
+// while the database is unavailable.
+var serviceCache = struct {
+	sync.RWMutex
+	services map[string]models.ServiceData
+}{services: map[string]models.ServiceData{}}
+
+// authenticateService returns the service of the given type the key belongs to. If the database can't be reached,
+// the key is checked against the services that were validated before. Keys that expired or were revoked by then
+// are still rejected, since the cached service holds the key state as of the last successful validation.
+func authenticateService(l *logrus.Entry, serviceType string, key string) (models.ServiceData, error) {
+	service, err := models.GetServiceByKey(serviceType, key)
+	if err == nil {
+		serviceCache.Lock()
+		serviceCache.services[service.ID] = service
+		serviceCache.Unlock()
+		return service, nil
+	}
+	if errors.Is(err, models.ErrInvalidServiceKey) {
+		return models.ServiceData{}, err
+	}
+
+	serviceCache.RLock()
+	defer serviceCache.RUnlock()
+	for _, cached := range serviceCache.services {
+		if cached.ServiceType == serviceType && cached.CheckKey(key) {
+			l.WithError(err).Warn("Could not validate service key, using the cached service")
+			return cached, nil
+		}
+	}
+	return models.ServiceData{}, err
+}
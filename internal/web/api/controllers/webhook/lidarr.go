@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryLidarrWebhook is the name of the repository for the Lidarr webhook
+	RepositoryLidarrWebhook = "lidarr"
+)
+
+func init() {
+	Register(RepositoryLidarrWebhook, LidarrMonitoringService{},
+		"Grab", "Download", "Rename", "Retag", "AlbumDelete", "ArtistDelete", "Health", "HealthRestored",
+		"ApplicationUpdate", "Test",
+	)
+}
+
+// LidarrMonitoringService is the struct for the Lidarr webhook
+type LidarrMonitoringService struct{}
+
+// LidarrWebhook parses the Lidarr webhook (artist, album and track file events) and stores it.
+func (lms LidarrMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Info("Firing webhook for Lidarr")
+
+	// Parse the request body into a string (in case we need to re-process the request)
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	lidarrWebhookData := models.LidarrWebhookData{}
+	err = lidarrWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("could not parse data (%w): %w", ErrBadRequestData, err)
+	}
+
+	// Health events share a format across the Servarr applications
+	if isServarrHealthEvent(lidarrWebhookData.EventType) {
+		return storeServarrHealthData(l, r, RepositoryLidarrWebhook, body)
+	}
+
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryLidarrWebhook, lidarrWebhookData.EventType, body, lidarrWebhookData)
+
+	// Link grabs to the Prowlarr grab of the same release
+	if lidarrWebhookData.EventType == "Grab" && lidarrWebhookData.Release != nil {
+		lidarrWebhookData.ProwlarrGrabID = findProwlarrGrab(l, r, lidarrWebhookData.Release.ReleaseTitle)
+	}
+
+	return StoreEvent(r, lidarrWebhookData)
+}
+
+// LegacyEvent returns the model the Lidarr events were stored as before events were stored in envelopes.
+func (lms LidarrMonitoringService) LegacyEvent(eventType string) models.Event {
+	return servarrLegacyEvent(eventType, &models.LidarrWebhookData{})
+}
@@ -3,7 +3,6 @@ package webhook
 import (
 	"fmt"
 	"net/http"
-	"plex_monitor/internal/database"
 	"plex_monitor/internal/database/models"
 
 	"github.com/sirupsen/logrus"
@@ -14,22 +13,37 @@ const (
 	RepositoryOmbiWebhook = "ombi"
 )
 
+func init() {
+	Register(RepositoryOmbiWebhook, OmbiMonitoringService{},
+		"NewRequest", "RequestApproved", "RequestAvailable", "RequestDeclined", "ItemAddedToFaultQueue", "Issue",
+		"IssueComment", "IssueResolved", "Test",
+	)
+}
+
 // OmbiMonitoringService is the struct for the Ombi webhook
 type OmbiMonitoringService struct{}
 
-func (rms OmbiMonitoringService) fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+func (rms OmbiMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
 	l.Info("Firing webhook for Ombi")
 
-	ombiWebhookData := models.OmbiWebhookData{}
-	err := ombiWebhookData.FromHTTPRequest(r)
+	body, err := readBody(r)
 	if err != nil {
-		return fmt.Errorf("unable to parse request (bad request data): %s", err)
+		return err
 	}
 
-	_, err = database.DB.Collection(database.WebhookCollectionName).InsertOne(database.Ctx, ombiWebhookData)
+	ombiWebhookData := models.OmbiWebhookData{}
+	err = ombiWebhookData.FromHTTPRequest(r)
 	if err != nil {
-		return fmt.Errorf("unable to write to database: %s", err)
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
 	}
 
-	return nil
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryOmbiWebhook, ombiWebhookData.Envelope().EventType, body, ombiWebhookData)
+
+	return StoreEvent(r, ombiWebhookData)
+}
+
+// LegacyEvent returns the model the Ombi events were stored as before events were stored in envelopes.
+func (rms OmbiMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.OmbiWebhookData{}
 }
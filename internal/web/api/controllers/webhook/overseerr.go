@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryOverseerrWebhook is the name of the repository for the Overseerr webhook
+	RepositoryOverseerrWebhook = "overseerr"
+	// RepositoryJellyseerrWebhook is the name of the repository for the Jellyseerr webhook
+	RepositoryJellyseerrWebhook = "jellyseerr"
+)
+
+func init() {
+	for _, serviceName := range []string{RepositoryOverseerrWebhook, RepositoryJellyseerrWebhook} {
+		Register(serviceName, OverseerrMonitoringService{serviceName: serviceName},
+			"MEDIA_PENDING", "MEDIA_AUTO_REQUESTED", "MEDIA_APPROVED", "MEDIA_AUTO_APPROVED", "MEDIA_AVAILABLE",
+			"MEDIA_DECLINED", "MEDIA_FAILED", "ISSUE_CREATED", "ISSUE_REOPENED", "ISSUE_COMMENT", "ISSUE_RESOLVED",
+			"TEST_NOTIFICATION",
+		)
+	}
+}
+
+// OverseerrMonitoringService is the struct for the Overseerr and Jellyseerr webhooks, which share a payload format
+type OverseerrMonitoringService struct {
+	serviceName string
+}
+
+func (oms OverseerrMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Infof("Firing webhook for %s", oms.serviceName)
+
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	overseerrWebhookData := models.OverseerrWebhookData{}
+	err = overseerrWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	overseerrWebhookData.ServiceName = oms.serviceName
+
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, oms.serviceName, overseerrWebhookData.Envelope().EventType, body, overseerrWebhookData)
+
+	return StoreEvent(r, overseerrWebhookData)
+}
+
+// LegacyEvent returns the model the Overseerr events were stored as before events were stored in envelopes.
+func (oms OverseerrMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.OverseerrWebhookData{}
+}
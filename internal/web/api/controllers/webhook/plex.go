@@ -1,9 +1,10 @@
 package webhook
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"plex_monitor/internal/database"
 	"plex_monitor/internal/database/models"
 
 	"github.com/sirupsen/logrus"
@@ -14,28 +15,63 @@ const (
 	RepositoryPlexName = "plex"
 )
 
+func init() {
+	Register(RepositoryPlexName, PlexMonitoringService{},
+		"media.play", "media.pause", "media.resume", "media.stop", "media.scrobble", "media.rate", "library.new",
+		"library.on.deck", "playback.started", "device.new", "admin.database.backup", "admin.database.corrupted",
+	)
+}
+
 // PlexMonitoringService is the struct for the Plex webhook
 type PlexMonitoringService struct{}
 
 // PlexWebhook is the endpoint that handles the inital request for webhooks and routes down to the service-specific func.
-func (pms PlexMonitoringService) fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+func (pms PlexMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
 	l.Info("Firing webhook for Plex")
 
 	err := r.ParseMultipartForm(128 << 20) // Max size 128MB
 	if err != nil {
-		return fmt.Errorf("unable to parse multipart form: %s", err)
+		return fmt.Errorf("unable to parse multipart form (%w): %s", ErrBadRequestData, err)
 	}
 
 	plexWebhookRequest := models.PlexWebhookData{}
 	err = plexWebhookRequest.FromHTTPRequest(r)
 	if err != nil {
-		return fmt.Errorf("unable to parse request (bad request data): %s", err)
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
 	}
 
-	_, err = database.DB.Collection(database.WebhookCollectionName).InsertOne(database.Ctx, plexWebhookRequest)
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryPlexName, plexWebhookRequest.Event, []byte(r.FormValue("payload")), plexWebhookRequest)
+
+	// Keep the thumbnail Plex sends with most events, a missing thumbnail shouldn't lose the event
+	thumbnailHash, err := storePlexThumbnail(r)
 	if err != nil {
-		return fmt.Errorf("unable to write to database: %s", err)
+		l.WithError(err).Warn("Could not store Plex thumbnail")
+	}
+	plexWebhookRequest.ThumbnailHash = thumbnailHash
+
+	return StoreEvent(r, plexWebhookRequest)
+}
+
+// storePlexThumbnail stores the thumb part of the request, if there is one, and returns its hash.
+func storePlexThumbnail(r *http.Request) (string, error) {
+	file, _, err := r.FormFile("thumb")
+	if errors.Is(err, http.ErrMissingFile) {
+		return "", nil
 	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	image, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	return models.StoreThumbnail(image)
+}
 
-	return nil
+// LegacyEvent returns the model the Plex events were stored as before events were stored in envelopes.
+func (pms PlexMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.PlexWebhookData{}
 }
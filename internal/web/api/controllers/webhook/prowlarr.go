@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryProwlarrWebhook is the name of the repository for the Prowlarr webhook
+	RepositoryProwlarrWebhook = "prowlarr"
+)
+
+func init() {
+	Register(RepositoryProwlarrWebhook, ProwlarrMonitoringService{},
+		"Grab", "Health", "HealthRestored", "ApplicationUpdate", "Test",
+	)
+}
+
+// ProwlarrMonitoringService is the struct for the Prowlarr webhook
+type ProwlarrMonitoringService struct{}
+
+// ProwlarrWebhook parses the Prowlarr webhook (grabs, health and application updates) and stores it.
+func (pms ProwlarrMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Info("Firing webhook for Prowlarr")
+
+	// Parse the request body into a string (in case we need to re-process the request)
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	prowlarrWebhookData := models.ProwlarrWebhookData{}
+	err = prowlarrWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("could not parse data (%w): %w", ErrBadRequestData, err)
+	}
+
+	// Health events share a format across the Servarr applications, indexer failures are parsed out of them there
+	if isServarrHealthEvent(prowlarrWebhookData.EventType) {
+		return storeServarrHealthData(l, r, RepositoryProwlarrWebhook, body)
+	}
+
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryProwlarrWebhook, prowlarrWebhookData.EventType, body, prowlarrWebhookData)
+
+	id, err := insertWebhookData(r, prowlarrWebhookData)
+	if err != nil {
+		return err
+	}
+
+	// Link the grabs the Servarr applications already reported for this release
+	if prowlarrWebhookData.EventType == "Grab" && prowlarrWebhookData.Release != nil {
+		err = models.LinkServarrGrabs(id, prowlarrWebhookData.Release.ReleaseTitle, receivedAt(r))
+		if err != nil {
+			l.WithError(err).Warn("Could not link Servarr grabs to Prowlarr grab")
+		}
+	}
+
+	return nil
+}
+
+// LegacyEvent returns the model the Prowlarr events were stored as before events were stored in envelopes.
+func (pms ProwlarrMonitoringService) LegacyEvent(eventType string) models.Event {
+	return servarrLegacyEvent(eventType, &models.ProwlarrWebhookData{})
+}
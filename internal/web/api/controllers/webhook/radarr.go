@@ -1,13 +1,9 @@
 package webhook
 
 import (
-	"bytes"
 	"fmt"
-	"io"
 	"net/http"
-	"plex_monitor/internal/database"
 	"plex_monitor/internal/database/models"
-	"strings"
 
 	"github.com/sirupsen/logrus"
 )
@@ -17,56 +13,49 @@ const (
 	RepositoryRadarrWebhook = "radarr"
 )
 
+func init() {
+	Register(RepositoryRadarrWebhook, RadarrMonitoringService{},
+		"Grab", "Download", "Rename", "MovieAdded", "MovieDelete", "MovieFileDelete", "Health", "HealthRestored",
+		"ApplicationUpdate", "ManualInteractionRequired", "Test",
+	)
+}
+
 // RadarrMonitoringService is the struct for the Radarr webhook
 type RadarrMonitoringService struct{}
 
 // RadarrWebhook is the endpoint that handles the inital request for webhooks and routes down to the service-specific func.
-func (rms RadarrMonitoringService) fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+func (rms RadarrMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
 	l.Info("Firing webhook for Radarr")
 
 	// Parse the request body into a string (in case we need to re-process the request)
-	body, err := io.ReadAll(r.Body)
+	body, err := readBody(r)
 	if err != nil {
-		return fmt.Errorf("could not parse request body: %w", err)
+		return err
 	}
 
-	// Set the request body back to the original so we can parse it again
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
-
 	radarrWebhookData := models.RadarrWebhookData{}
 	err = radarrWebhookData.FromHTTPRequest(r)
 	if err != nil {
-		return fmt.Errorf("could not parse data (bad request data): %w", err)
+		return fmt.Errorf("could not parse data (%w): %w", ErrBadRequestData, err)
 	}
 
 	// If the event type contains "Health", then we need to parse the data differently.
-	if strings.Contains(radarrWebhookData.EventType, "Health") {
-		// Set the request body back to the original so we can parse it again
-		r.Body = io.NopCloser(bytes.NewBuffer(body))
-
-		// Parse the data into the health struct
-		healthData := models.ServarrHealthData{}
-		err = healthData.FromHTTPRequest(r)
-		if err != nil {
-			return fmt.Errorf("could not parse data (bad request data): %w", err)
-		}
-
-		healthData.ServiceName = "radarr"
+	if isServarrHealthEvent(radarrWebhookData.EventType) {
+		return storeServarrHealthData(l, r, RepositoryRadarrWebhook, body)
+	}
 
-		// Store the data in the database
-		_, err := database.DB.Collection(database.WebhookCollectionName).InsertOne(database.Ctx, healthData)
-		if err != nil {
-			return fmt.Errorf("could not store data: %w", err)
-		}
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryRadarrWebhook, radarrWebhookData.EventType, body, radarrWebhookData)
 
-		// Return early since we don't need to do anything else
-		return nil
+	// Link grabs to the Prowlarr grab of the same release
+	if radarrWebhookData.EventType == "Grab" && radarrWebhookData.Release != nil {
+		radarrWebhookData.ProwlarrGrabID = findProwlarrGrab(l, r, radarrWebhookData.Release.ReleaseTitle)
 	}
 
-	_, err = database.DB.Collection(database.WebhookCollectionName).InsertOne(database.Ctx, radarrWebhookData)
-	if err != nil {
-		return fmt.Errorf("could not store data: %w", err)
-	}
+	return StoreEvent(r, radarrWebhookData)
+}
 
-	return nil
+// LegacyEvent returns the model the Radarr events were stored as before events were stored in envelopes.
+func (rms RadarrMonitoringService) LegacyEvent(eventType string) models.Event {
+	return servarrLegacyEvent(eventType, &models.RadarrWebhookData{})
 }
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryReadarrWebhook is the name of the repository for the Readarr webhook
+	RepositoryReadarrWebhook = "readarr"
+)
+
+func init() {
+	Register(RepositoryReadarrWebhook, ReadarrMonitoringService{},
+		"Grab", "Download", "Rename", "Retag", "AuthorDelete", "BookDelete", "BookFileDelete", "Health",
+		"HealthRestored", "ApplicationUpdate", "Test",
+	)
+}
+
+// ReadarrMonitoringService is the struct for the Readarr webhook
+type ReadarrMonitoringService struct{}
+
+// ReadarrWebhook parses the Readarr webhook (author, book and book file events) and stores it.
+func (rms ReadarrMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Info("Firing webhook for Readarr")
+
+	// Parse the request body into a string (in case we need to re-process the request)
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	readarrWebhookData := models.ReadarrWebhookData{}
+	err = readarrWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("could not parse data (%w): %w", ErrBadRequestData, err)
+	}
+
+	// Health events share a format across the Servarr applications
+	if isServarrHealthEvent(readarrWebhookData.EventType) {
+		return storeServarrHealthData(l, r, RepositoryReadarrWebhook, body)
+	}
+
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryReadarrWebhook, readarrWebhookData.EventType, body, readarrWebhookData)
+
+	// Link grabs to the Prowlarr grab of the same release
+	if readarrWebhookData.EventType == "Grab" && readarrWebhookData.Release != nil {
+		readarrWebhookData.ProwlarrGrabID = findProwlarrGrab(l, r, readarrWebhookData.Release.ReleaseTitle)
+	}
+
+	return StoreEvent(r, readarrWebhookData)
+}
+
+// LegacyEvent returns the model the Readarr events were stored as before events were stored in envelopes.
+func (rms ReadarrMonitoringService) LegacyEvent(eventType string) models.Event {
+	return servarrLegacyEvent(eventType, &models.ReadarrWebhookData{})
+}
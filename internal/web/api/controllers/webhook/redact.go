@@ -0,0 +1,337 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// redactedValue replaces the redacted secrets in the stored raw requests
+const redactedValue = "[REDACTED]"
+
+var ipv4Regex = regexp.MustCompile(`\b(\d{1,3})\.(\d{1,3})\.(\d{1,3})\.(\d{1,3})\b`)
+
+// RedactionConfig is what is redacted from the raw requests before they are stored.
+type RedactionConfig struct {
+	// Headers are the names of the headers whose values are redacted
+	Headers []string
+	// QueryParams are the names of the query parameters and form fields whose values are redacted
+	QueryParams []string
+	// JSONPaths are the dotted paths of the JSON values that are redacted, in the request body or in the JSON form
+	// fields like the Plex payload. "*" matches any field, "**" any number of fields, and arrays are matched
+	// element-wise (e.g. "Player.publicAddress" or "**.apiKey").
+	JSONPaths []string
+	// MaskIPs masks the last part of the IP addresses in the headers and body
+	MaskIPs bool
+}
+
+// DefaultRedaction returns the default redaction, which removes the webhook keys, the common authentication headers
+// and API keys, and masks IP addresses.
+func DefaultRedaction() RedactionConfig {
+	return RedactionConfig{
+		Headers:     []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key", "X-Plex-Token", ServiceKeyHeader},
+		QueryParams: []string{ServiceKeyQueryParam, "apikey", "api_key", "token", "X-Plex-Token"},
+		JSONPaths:   []string{"**.apiKey", "**.api_key", "**.password", "**.token"},
+		MaskIPs:     true,
+	}
+}
+
+// Redaction is what is redacted from the raw requests before they are stored.
+var Redaction = DefaultRedaction()
+
+// WireEncryptionKey is the AES key the unredacted raw requests are encrypted with. When it is set, the raw requests
+// are also stored as they were received (see models.StoreUnredactedRawWire).
+var WireEncryptionKey []byte
+
+// redactRequest returns the raw request with the secrets removed, as configured by the redaction config.
+func (rc RedactionConfig) redactRequest(r *http.Request) ([]byte, error) {
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	redacted := r.Clone(r.Context())
+
+	// Headers
+	for _, name := range rc.Headers {
+		if _, ok := redacted.Header[http.CanonicalHeaderKey(name)]; ok {
+			redacted.Header.Set(name, redactedValue)
+		}
+	}
+	if rc.MaskIPs {
+		for name, values := range redacted.Header {
+			for i := range values {
+				values[i] = maskIPs(values[i])
+			}
+			redacted.Header[name] = values
+		}
+	}
+
+	// Query parameters
+	if query, changed := rc.redactQuery(redacted.URL.RawQuery); changed {
+		redacted.URL.RawQuery = query
+		redacted.RequestURI = redacted.URL.RequestURI()
+	}
+
+	// Body
+	body = rc.redactBody(redacted.Header.Get("Content-Type"), body)
+	redacted.Body = io.NopCloser(bytes.NewReader(body))
+	redacted.ContentLength = int64(len(body))
+	if redacted.Header.Get("Content-Length") != "" {
+		redacted.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	return httputil.DumpRequest(redacted, true)
+}
+
+// redactBody returns the request body with the secrets removed, based on its content type. Bodies that can't be parsed
+// only have their IP addresses masked.
+func (rc RedactionConfig) redactBody(contentType string, body []byte) []byte {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		form, _ := rc.redactQuery(string(body))
+		return []byte(form)
+	case "multipart/form-data":
+		redacted, err := rc.redactMultipart(body, params["boundary"])
+		if err != nil {
+			return rc.redactText(body)
+		}
+		return redacted
+	default:
+		if redacted, ok := rc.redactJSON(body); ok {
+			return redacted
+		}
+		return rc.redactText(body)
+	}
+}
+
+// redactMultipart redacts the form fields of the multipart body, leaving uploaded files as they are.
+func (rc RedactionConfig) redactMultipart(body []byte, boundary string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	err := writer.SetBoundary(boundary)
+	if err != nil {
+		return nil, fmt.Errorf("could not redact multipart body: %w", err)
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not redact multipart body: %w", err)
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("could not redact multipart body: %w", err)
+		}
+		if part.FileName() == "" {
+			if containsName(rc.QueryParams, part.FormName()) {
+				value = []byte(redactedValue)
+			} else if redacted, ok := rc.redactJSON(value); ok {
+				value = redacted
+			} else {
+				value = rc.redactText(value)
+			}
+		}
+
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader(part.Header))
+		if err != nil {
+			return nil, fmt.Errorf("could not redact multipart body: %w", err)
+		}
+		_, err = partWriter.Write(value)
+		if err != nil {
+			return nil, fmt.Errorf("could not redact multipart body: %w", err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not redact multipart body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// redactQuery redacts the configured query parameters of the URL encoded query or form, and masks the IP addresses in
+// it. The order of the parameters is kept, and it returns true if anything was changed.
+func (rc RedactionConfig) redactQuery(query string) (string, bool) {
+	changed := false
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		name, value, _ := strings.Cut(pair, "=")
+		unescapedName, err := url.QueryUnescape(name)
+		if err != nil {
+			unescapedName = name
+		}
+
+		redacted := value
+		if containsName(rc.QueryParams, unescapedName) {
+			redacted = url.QueryEscape(redactedValue)
+		} else if rc.MaskIPs {
+			redacted = maskIPs(value)
+		}
+		if redacted != value {
+			pairs[i] = name + "=" + redacted
+			changed = true
+		}
+	}
+
+	if !changed {
+		return query, false
+	}
+	return strings.Join(pairs, "&"), true
+}
+
+// redactJSON redacts the configured paths of the JSON document and masks the IP addresses in its strings. It returns
+// false if the data isn't JSON. The document is only re-encoded if something was redacted.
+func (rc RedactionConfig) redactJSON(data []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return nil, false
+	}
+
+	changed := false
+	for _, path := range rc.JSONPaths {
+		if path == "" {
+			continue
+		}
+		value = redactJSONPath(value, strings.Split(path, "."), &changed)
+	}
+	if rc.MaskIPs {
+		value = maskJSONIPs(value, &changed)
+	}
+	if !changed {
+		return data, true
+	}
+
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	return redacted, true
+}
+
+// redactField redacts the value of the form field or decoded JSON value if its name is one of the configured query
+// parameters, and masks the IP addresses in it otherwise.
+func (rc RedactionConfig) redactField(name string, value interface{}) interface{} {
+	if containsName(rc.QueryParams, name) {
+		return redactedValue
+	}
+	if rc.MaskIPs {
+		changed := false
+		value = maskJSONIPs(value, &changed)
+	}
+	return value
+}
+
+// redactText masks the IP addresses in a body that couldn't be parsed.
+func (rc RedactionConfig) redactText(data []byte) []byte {
+	if !rc.MaskIPs {
+		return data
+	}
+	return []byte(maskIPs(string(data)))
+}
+
+// containsName returns true if the name is one of the names, ignoring case.
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactJSONPath replaces the values at the path of the decoded JSON value.
+func redactJSONPath(value interface{}, path []string, changed *bool) interface{} {
+	if len(path) == 0 {
+		*changed = true
+		return redactedValue
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = redactJSONPath(v[i], path, changed)
+		}
+	case map[string]interface{}:
+		segment := path[0]
+		if segment == "**" {
+			// Match the rest of the path here, and in every nested value
+			value = redactJSONPath(v, path[1:], changed)
+			if object, ok := value.(map[string]interface{}); ok {
+				for key := range object {
+					object[key] = redactJSONPath(object[key], path, changed)
+				}
+			}
+			return value
+		}
+		for key := range v {
+			if segment == "*" || strings.EqualFold(segment, key) {
+				v[key] = redactJSONPath(v[key], path[1:], changed)
+			}
+		}
+	}
+	return value
+}
+
+// maskJSONIPs masks the IP addresses in the strings of the decoded JSON value.
+func maskJSONIPs(value interface{}, changed *bool) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = maskJSONIPs(v[i], changed)
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = maskJSONIPs(v[key], changed)
+		}
+	case string:
+		masked := maskIPs(v)
+		if masked != v {
+			*changed = true
+		}
+		return masked
+	}
+	return value
+}
+
+// maskIPs masks the last part of the IP addresses in the string, e.g. 203.0.113.7 becomes 203.0.113.x. Strings that are
+// an IPv6 address are masked down to the first 48 bits.
+func maskIPs(s string) string {
+	if ip := net.ParseIP(s); ip != nil && ip.To4() == nil {
+		return ip.Mask(net.CIDRMask(48, 128)).String() + "x"
+	}
+
+	return ipv4Regex.ReplaceAllStringFunc(s, func(match string) string {
+		ip := net.ParseIP(match)
+		if ip == nil || ip.To4() == nil {
+			return match
+		}
+		return match[:strings.LastIndex(match, ".")] + ".x"
+	})
+}
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+	"sort"
+	"sync"
+
+	"github.com/go-chi/render"
+)
+
+// ServiceDescription describes a service registered with the webhook entrypoint.
+type ServiceDescription struct {
+	Name       string   `json:"name"`
+	EventTypes []string `json:"eventTypes"`
+}
+
+// registeredService is a service monitor along with the event types it supports.
+type registeredService struct {
+	monitor    ServiceMonitor
+	eventTypes []string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]registeredService{}
+)
+
+// Register makes the service monitor available to the webhook entrypoint under the supplied name, which is the value
+// of the "service" query parameter and the service type of the keys. The event types are only used to describe the
+// service. Like database/sql.Register, it is meant to be called from init and panics if the name is empty, the monitor
+// is nil or the name is already registered.
+func Register(name string, monitor ServiceMonitor, eventTypes ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" {
+		panic("webhook: Register service with an empty name")
+	}
+	if monitor == nil {
+		panic(fmt.Sprintf("webhook: Register service %s with a nil monitor", name))
+	}
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("webhook: Register called twice for service %s", name))
+	}
+
+	registry[name] = registeredService{monitor: monitor, eventTypes: eventTypes}
+}
+
+// Services returns the registered services sorted by name.
+func Services() []ServiceDescription {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	services := make([]ServiceDescription, 0, len(registry))
+	for name, service := range registry {
+		eventTypes := make([]string, len(service.eventTypes))
+		copy(eventTypes, service.eventTypes)
+		services = append(services, ServiceDescription{Name: name, EventTypes: eventTypes})
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	return services
+}
+
+// getService returns the monitoring service registered under the supplied name. The monitor is nil if there is no
+// such service.
+func getService(svcName string) MonitoringService {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return MonitoringService{monitor: registry[svcName].monitor}
+}
+
+// legacyEvent returns the model the registered service stored the event as before events were stored in envelopes,
+// or nil if the service isn't registered or doesn't implement LegacyEventDecoder.
+func legacyEvent(svcName string, eventType string) models.Event {
+	decoder, ok := getService(svcName).monitor.(LegacyEventDecoder)
+	if !ok {
+		return nil
+	}
+	return decoder.LegacyEvent(eventType)
+}
+
+// WrapLegacyEvents wraps the events that were stored before events were stored in envelopes, decoding their payload
+// with the model of the registered service. It returns the number of events that were wrapped.
+func WrapLegacyEvents() (int, error) {
+	return models.MigrateLegacyEvents(legacyEvent)
+}
+
+// ListServices is the endpoint that lists the registered services and the event types they support.
+func ListServices(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, map[string][]ServiceDescription{"data": Services()})
+}
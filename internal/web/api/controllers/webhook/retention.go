@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"plex_monitor/internal/database/models"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultWireSweepInterval is how often the raw requests are swept when no interval is configured
+const DefaultWireSweepInterval = time.Hour
+
+// WireSweeper removes the raw requests that the retention policies of their services no longer keep.
+type WireSweeper struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// StartWireSweeper sweeps the raw requests right away and then at every interval, until it is stopped. Services
+// without a retention policy keep their raw requests forever (see models.ServiceData.WireRetentionPolicy).
+func StartWireSweeper(interval time.Duration) *WireSweeper {
+	if interval <= 0 {
+		interval = DefaultWireSweepInterval
+	}
+
+	ws := &WireSweeper{stop: make(chan struct{})}
+	ws.wg.Add(1)
+	go func() {
+		defer ws.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sweepWires(time.Now())
+
+			select {
+			case <-ws.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return ws
+}
+
+// Stop stops the sweeper, waiting for a running sweep to finish.
+func (ws *WireSweeper) Stop() {
+	close(ws.stop)
+	ws.wg.Wait()
+}
+
+// sweepWires applies the retention policy of every service to its raw requests.
+func sweepWires(now time.Time) {
+	services, err := models.GetAllServices()
+	if err != nil {
+		logrus.WithError(err).Error("Could not load services to sweep raw requests")
+		return
+	}
+
+	for _, service := range services {
+		policy, ok := service.WireRetentionPolicy()
+		if !ok {
+			continue
+		}
+
+		l := logrus.WithFields(logrus.Fields{"serviceId": service.ID, "days": policy.Days, "failedOnly": policy.FailedOnly})
+		removed, err := models.SweepRawWires(service.ID, policy, now)
+		if err != nil {
+			l.WithError(err).Error("Could not sweep raw requests")
+		}
+		if removed > 0 {
+			l.Infof("Removed %d raw request(s)", removed)
+		}
+	}
+}
@@ -1,14 +1,32 @@
 package webhook
 
 import (
+	"os"
+	"plex_monitor/internal/web/middleware"
+
 	"github.com/go-chi/chi"
+	"github.com/go-chi/jwtauth"
 )
 
 // Routes returns the router for the webhook controller
 func Routes() *chi.Mux {
 	router := chi.NewRouter()
+	tokenAuth := jwtauth.New("HS256", []byte(os.Getenv("SECRET_KEY")), nil)
 
+	// Public endpoints, authenticated with the service keys
 	router.Post("/", Entry)
 
+	// Protected endpoints
+	router.Group(func(r chi.Router) {
+		r.Use(jwtauth.Verifier(tokenAuth))
+		r.Use(jwtauth.Authenticator)
+		r.Use(middleware.CreateUserContext)
+
+		r.Get("/services", ListServices)
+		r.Get("/spool", SpoolMetrics)
+		r.Get("/drift", ListSchemaDrift)
+		r.Get("/health", ListHealthIssues)
+	})
+
 	return router
 }
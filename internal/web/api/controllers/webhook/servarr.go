@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"plex_monitor/internal/database/models"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// isServarrHealthEvent checks if the event type sent by a Servarr application is a health event (Health, HealthRestored).
+func isServarrHealthEvent(eventType string) bool {
+	return strings.Contains(eventType, "Health")
+}
+
+// servarrLegacyEvent returns the model a Servarr application event was stored as before events were stored in
+// envelopes. Health events were stored as health data, the others as the supplied event.
+func servarrLegacyEvent(eventType string, event models.Event) models.Event {
+	if isServarrHealthEvent(eventType) {
+		return &models.ServarrHealthData{}
+	}
+	return event
+}
+
+// storeServarrHealthData parses the supplied body as a Servarr health event and stores it for the given service.
+func storeServarrHealthData(l *logrus.Entry, r *http.Request, serviceName string, body []byte) error {
+	// Set the request body back to the original so we can parse it again
+	r.Body = io.NopCloser(bytes.NewBuffer(body))
+
+	// Parse the data into the health struct
+	healthData := models.ServarrHealthData{}
+	err := healthData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("could not parse data (%w): %w", ErrBadRequestData, err)
+	}
+
+	healthData.ServiceName = serviceName
+	recordSchemaDrift(l, r, serviceName, healthData.EventType, body, healthData)
+
+	id, err := insertWebhookData(r, healthData)
+	if err != nil {
+		return err
+	}
+
+	trackHealthIssue(l, r, healthData, id)
+	return nil
+}
+
+// trackHealthIssue opens or closes the health issue of the stored health event. Failures are logged rather than
+// returned since the event itself was stored.
+func trackHealthIssue(l *logrus.Entry, r *http.Request, healthData models.ServarrHealthData, eventID primitive.ObjectID) {
+	serviceID, instance := "", ""
+	if service, ok := ServiceFromContext(r.Context()); ok {
+		serviceID, instance = service.ID, service.Instance
+	}
+	// Prefer the instance name the application reports, like the event envelope does
+	if healthData.InstanceName != nil && *healthData.InstanceName != "" {
+		instance = *healthData.InstanceName
+	}
+
+	err := models.TrackHealthIssue(healthData, serviceID, instance, &eventID, receivedAt(r))
+	if err != nil {
+		l.WithError(err).Warn("Could not track health issue")
+	}
+}
+
+// findProwlarrGrab returns the ID of the Prowlarr grab for the release grabbed by a Servarr application, if any. Failing
+// to link the grabs is logged rather than returned so the event itself is still stored.
+func findProwlarrGrab(l *logrus.Entry, r *http.Request, releaseTitle string) *primitive.ObjectID {
+	prowlarrGrabID, err := models.FindProwlarrGrab(releaseTitle, receivedAt(r))
+	if err != nil {
+		l.WithError(err).Warn("Could not look up Prowlarr grab for release")
+		return nil
+	}
+
+	return prowlarrGrabID
+}
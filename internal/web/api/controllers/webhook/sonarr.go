@@ -1,13 +1,9 @@
 package webhook
 
 import (
-	"bytes"
 	"fmt"
-	"io"
 	"net/http"
-	"plex_monitor/internal/database"
 	"plex_monitor/internal/database/models"
-	"strings"
 
 	"github.com/sirupsen/logrus"
 )
@@ -17,57 +13,50 @@ const (
 	RepositorySonarrWebhook = "sonarr"
 )
 
+func init() {
+	Register(RepositorySonarrWebhook, SonarrMonitoringService{},
+		"Grab", "Download", "Rename", "SeriesAdd", "SeriesDelete", "EpisodeFileDelete", "Health", "HealthRestored",
+		"ApplicationUpdate", "ManualInteractionRequired", "Test",
+	)
+}
+
 // SonarrMonitoringService is the struct for the Sonarr webhook
 type SonarrMonitoringService struct{}
 
 // SonarrWebhook is the endpoint that handles the inital request for webhooks and routes down to the service-specific func.
-func (rms SonarrMonitoringService) fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+func (rms SonarrMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
 	l.Info("Firing webhook for Sonarr")
 
 	// Parse the request body into a string (in case we need to re-process the request)
-	body, err := io.ReadAll(r.Body)
+	body, err := readBody(r)
 	if err != nil {
-		return fmt.Errorf("could not parse request body: %w", err)
+		return err
 	}
 
-	// Set the request body back to the original so we can parse it again
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
-
 	sonarrWebhookData := models.SonarrWebhookData{}
 	err = sonarrWebhookData.FromHTTPRequest(r)
 
 	if err != nil {
-		return fmt.Errorf("unable to parse request (bad request data): %s", err)
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
 	}
 
 	// If the event type contains "Health", then we need to parse the data differently.
-	if strings.Contains(sonarrWebhookData.EventType, "Health") {
-		// Set the request body back to the original so we can parse it again
-		r.Body = io.NopCloser(bytes.NewBuffer(body))
-
-		// Parse the data into the health struct
-		healthData := models.ServarrHealthData{}
-		err = healthData.FromHTTPRequest(r)
-		if err != nil {
-			return fmt.Errorf("could not parse data (bad request data): %w", err)
-		}
-
-		healthData.ServiceName = "sonarr"
+	if isServarrHealthEvent(sonarrWebhookData.EventType) {
+		return storeServarrHealthData(l, r, RepositorySonarrWebhook, body)
+	}
 
-		// Store the data in the database
-		_, err := database.DB.Collection(database.WebhookCollectionName).InsertOne(database.Ctx, healthData)
-		if err != nil {
-			return fmt.Errorf("could not store data: %w", err)
-		}
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositorySonarrWebhook, sonarrWebhookData.EventType, body, sonarrWebhookData)
 
-		// Return early since we don't need to do anything else
-		return nil
+	// Link grabs to the Prowlarr grab of the same release
+	if sonarrWebhookData.EventType == "Grab" && sonarrWebhookData.Release != nil {
+		sonarrWebhookData.ProwlarrGrabID = findProwlarrGrab(l, r, sonarrWebhookData.Release.ReleaseTitle)
 	}
 
-	_, err = database.DB.Collection(database.WebhookCollectionName).InsertOne(database.Ctx, sonarrWebhookData)
-	if err != nil {
-		return fmt.Errorf("unable to write to database: %s", err)
-	}
+	return StoreEvent(r, sonarrWebhookData)
+}
 
-	return nil
+// LegacyEvent returns the model the Sonarr events were stored as before events were stored in envelopes.
+func (rms SonarrMonitoringService) LegacyEvent(eventType string) models.Event {
+	return servarrLegacyEvent(eventType, &models.SonarrWebhookData{})
 }
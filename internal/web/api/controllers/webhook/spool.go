@@ -0,0 +1,549 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"plex_monitor/internal/database"
+	"plex_monitor/internal/database/models"
+	"plex_monitor/internal/utils"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// DefaultSpoolWorkers is the number of workers used when none is configured
+	DefaultSpoolWorkers = 4
+	// SpoolMaxAttempts is the number of times a spooled request is processed while the database is available before
+	// it is moved to the failed directory of the spool
+	SpoolMaxAttempts = 5
+	// DefaultSpoolFailedRetention is how long the requests in the failed directory of the spool are kept when no
+	// retention is configured
+	DefaultSpoolFailedRetention = 7 * 24 * time.Hour
+
+	spoolFileExt        = ".json"
+	spoolFailedDir      = "failed"
+	spoolQueueSize      = 1024
+	spoolMinBackoff     = time.Second
+	spoolMaxBackoff     = 5 * time.Minute
+	spoolRescanInterval = 30 * time.Second
+	spoolPingTimeout    = 5 * time.Second
+)
+
+// errSpoolPermanent marks errors that retrying won't fix, such as a service that is no longer registered. Requests
+// that can't be parsed (see ErrBadRequestData) fail permanently too.
+var errSpoolPermanent = errors.New("permanent failure")
+
+// SpoolFailedRetention is how long the requests in the failed directory of the spool are kept before they are
+// removed. Zero or less keeps them until they are removed by hand.
+var SpoolFailedRetention = DefaultSpoolFailedRetention
+
+// spooledRequest is a webhook request that was accepted and is waiting to be processed. The service is stored
+// without its keys, and the request as it was received is encrypted with WireEncryptionKey, so its secrets never hit
+// the disk in plain text. The ID of the raw request is set once it was stored, so retries don't store it again.
+type spooledRequest struct {
+	ServiceType   string              `json:"serviceType"`
+	Service       models.ServiceData  `json:"service"`
+	ReceivedAt    time.Time           `json:"receivedAt"`
+	EncryptedWire []byte              `json:"encryptedWire"`
+	RawWireID     *primitive.ObjectID `json:"rawWireId,omitempty"`
+}
+
+// spoolEntry is the state of a spooled request file.
+type spoolEntry struct {
+	receivedAt time.Time
+	attempts   int
+	retries    int
+	// queued is false when the queue was full, the rescan picks these up again
+	queued bool
+}
+
+// SpoolStats are the metrics of the spool.
+type SpoolStats struct {
+	Enabled          bool       `json:"enabled"`
+	Depth            int        `json:"depth"`
+	InFlight         int64      `json:"inFlight"`
+	Processed        int64      `json:"processed"`
+	Retried          int64      `json:"retried"`
+	Failed           int64      `json:"failed"`
+	OldestReceivedAt *time.Time `json:"oldestReceivedAt,omitempty"`
+}
+
+// Spool is a durable on-disk queue of webhook requests, stored by a pool of workers.
+type Spool struct {
+	dir     string
+	queue   chan string
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	entries map[string]*spoolEntry
+
+	inFlight  atomic.Int64
+	processed atomic.Int64
+	retried   atomic.Int64
+	failed    atomic.Int64
+}
+
+var (
+	spoolMu      sync.RWMutex
+	runningSpool *Spool
+)
+
+// StartSpool makes Entry accept webhook requests as soon as they are written to the supplied directory, and starts
+// the workers that store them. Requests left in the directory by a previous run are processed first. Failed requests
+// are retried with an exponential backoff; attempts made while the database is unreachable don't count towards
+// SpoolMaxAttempts, so the spool drains once the database is back. The spooled requests are encrypted, so
+// WireEncryptionKey must be set first.
+func StartSpool(dir string, workers int) (*Spool, error) {
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+
+	if runningSpool != nil {
+		return nil, fmt.Errorf("spool already started in %s", runningSpool.dir)
+	}
+	if len(WireEncryptionKey) == 0 {
+		return nil, errors.New("the spool requires a wire encryption key")
+	}
+	if workers <= 0 {
+		workers = DefaultSpoolWorkers
+	}
+
+	err := os.MkdirAll(filepath.Join(dir, spoolFailedDir), 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("could not create spool directory: %w", err)
+	}
+
+	s := &Spool{
+		dir:     dir,
+		queue:   make(chan string, spoolQueueSize),
+		stop:    make(chan struct{}),
+		entries: map[string]*spoolEntry{},
+	}
+
+	err = s.scan()
+	if err != nil {
+		return nil, err
+	}
+	s.sweepFailed(time.Now())
+
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	s.wg.Add(1)
+	go s.rescan()
+
+	runningSpool = s
+	return s, nil
+}
+
+// Stop stops the workers and goes back to processing requests synchronously. Requests that are still spooled stay on
+// disk and are processed by the next StartSpool.
+func (s *Spool) Stop() {
+	spoolMu.Lock()
+	if runningSpool == s {
+		runningSpool = nil
+	}
+	spoolMu.Unlock()
+
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// activeSpool returns the running spool, or nil if requests are processed synchronously.
+func activeSpool() *Spool {
+	spoolMu.RLock()
+	defer spoolMu.RUnlock()
+	return runningSpool
+}
+
+// Stats returns the current metrics of the spool.
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := SpoolStats{
+		Enabled:   true,
+		Depth:     len(s.entries),
+		InFlight:  s.inFlight.Load(),
+		Processed: s.processed.Load(),
+		Retried:   s.retried.Load(),
+		Failed:    s.failed.Load(),
+	}
+	for _, entry := range s.entries {
+		if stats.OldestReceivedAt == nil || entry.receivedAt.Before(*stats.OldestReceivedAt) {
+			receivedAt := entry.receivedAt
+			stats.OldestReceivedAt = &receivedAt
+		}
+	}
+	return stats
+}
+
+// enqueue writes the request to the spool directory and queues it for the workers. The request is durable once
+// enqueue returns without an error. The request is only written to disk encrypted.
+func (s *Spool) enqueue(serviceType string, service models.ServiceData, r *http.Request) error {
+	service.Keys = nil
+	req := spooledRequest{
+		ServiceType: serviceType,
+		Service:     service,
+		ReceivedAt:  time.Now(),
+	}
+
+	wire, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		return fmt.Errorf("could not dump request: %w", err)
+	}
+	req.EncryptedWire, err = utils.Encrypt(WireEncryptionKey, wire)
+	if err != nil {
+		return fmt.Errorf("could not encrypt request: %w", err)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("could not encode request: %w", err)
+	}
+
+	// The file name sorts by the time the request was received
+	name := fmt.Sprintf("%020d_%s_%s%s", req.ReceivedAt.UnixNano(), serviceType, primitive.NewObjectID().Hex(), spoolFileExt)
+	path := filepath.Join(s.dir, name)
+	err = writeFileSync(path, data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	entry := &spoolEntry{receivedAt: req.ReceivedAt}
+	s.entries[path] = entry
+	s.mu.Unlock()
+
+	s.push(path, entry)
+	return nil
+}
+
+// writeFileSync writes the file through a temporary file that is synced and renamed, so a crash never leaves a
+// partially written request behind.
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not create spool file: %w", err)
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not write spool file: %w", err)
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not write spool file: %w", err)
+	}
+	return nil
+}
+
+// push queues the spooled request without blocking. When the queue is full, the rescan queues it later.
+func (s *Spool) push(path string, entry *spoolEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case s.queue <- path:
+		entry.queued = true
+	default:
+		entry.queued = false
+	}
+}
+
+// scan adds the spooled requests in the directory that aren't known yet, oldest first.
+func (s *Spool) scan() error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*"+spoolFileExt))
+	if err != nil {
+		return fmt.Errorf("could not read spool directory: %w", err)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		s.mu.Lock()
+		_, known := s.entries[path]
+		entry := &spoolEntry{receivedAt: spoolFileTime(path)}
+		if !known {
+			s.entries[path] = entry
+		}
+		s.mu.Unlock()
+
+		if !known {
+			s.push(path, entry)
+		}
+	}
+	return nil
+}
+
+// spoolFileTime returns the time the request in the spool file was received, based on its name.
+func spoolFileTime(path string) time.Time {
+	var nanos int64
+	prefix, _, _ := strings.Cut(filepath.Base(path), "_")
+	_, err := fmt.Sscan(prefix, &nanos)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Unix(0, nanos)
+}
+
+// rescan periodically queues the requests that didn't fit in the queue.
+func (s *Spool) rescan() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(spoolRescanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.sweepFailed(time.Now())
+
+			s.mu.Lock()
+			unqueued := map[string]*spoolEntry{}
+			for path, entry := range s.entries {
+				if !entry.queued {
+					unqueued[path] = entry
+				}
+			}
+			s.mu.Unlock()
+
+			for path, entry := range unqueued {
+				s.push(path, entry)
+			}
+		}
+	}
+}
+
+// work processes spooled requests until the spool is stopped.
+func (s *Spool) work() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case path := <-s.queue:
+			s.handle(path)
+		}
+	}
+}
+
+// handle processes the spooled request, and removes it from the spool if it was stored or failed permanently.
+func (s *Spool) handle(path string) {
+	l := logrus.WithFields(logrus.Fields{"spoolFile": filepath.Base(path)})
+
+	s.inFlight.Add(1)
+	err := s.process(path)
+	s.inFlight.Add(-1)
+
+	if err == nil {
+		s.processed.Add(1)
+		s.remove(path)
+		return
+	}
+
+	permanent := errors.Is(err, errSpoolPermanent) || errors.Is(err, ErrBadRequestData)
+
+	s.mu.Lock()
+	entry, ok := s.entries[path]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	entry.retries++
+	// Only count the attempt if the database is available, so requests aren't dropped during an outage
+	if !permanent && database.Ping(spoolPingTimeout) == nil {
+		entry.attempts++
+	}
+	attempts, retries := entry.attempts, entry.retries
+	s.mu.Unlock()
+
+	if permanent || attempts >= SpoolMaxAttempts {
+		l.WithError(err).Error("Could not process spooled webhook, moving it to the failed directory")
+		s.failed.Add(1)
+		s.moveToFailed(path)
+		return
+	}
+
+	backoff := spoolBackoff(retries)
+	l.WithError(err).Warnf("Could not process spooled webhook, retrying in %s", backoff)
+	s.retried.Add(1)
+	time.AfterFunc(backoff, func() {
+		select {
+		case <-s.stop:
+		default:
+			s.push(path, entry)
+		}
+	})
+}
+
+// spoolBackoff returns the delay before the next retry, doubling from spoolMinBackoff up to spoolMaxBackoff.
+func spoolBackoff(retries int) time.Duration {
+	backoff := spoolMinBackoff
+	for i := 1; i < retries && backoff < spoolMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > spoolMaxBackoff {
+		backoff = spoolMaxBackoff
+	}
+	return backoff
+}
+
+// process reads the spooled request and processes it like Entry does for synchronous requests.
+func (s *Spool) process(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read spool file: %w: %s", errSpoolPermanent, err)
+	}
+
+	req := spooledRequest{}
+	err = json.Unmarshal(data, &req)
+	if err != nil {
+		return fmt.Errorf("could not decode spool file: %w: %s", errSpoolPermanent, err)
+	}
+
+	monitoringService := getService(req.ServiceType)
+	if monitoringService.monitor == nil {
+		return fmt.Errorf("service %s is not registered: %w", req.ServiceType, errSpoolPermanent)
+	}
+
+	wire, err := utils.Decrypt(WireEncryptionKey, req.EncryptedWire)
+	if err != nil {
+		return fmt.Errorf("could not decrypt spooled request: %w: %s", errSpoolPermanent, err)
+	}
+
+	r, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(wire)))
+	if err != nil {
+		return fmt.Errorf("could not parse spooled request: %w: %s", errSpoolPermanent, err)
+	}
+	ctx := context.WithValue(context.Background(), ContextKeyService, req.Service)
+	ctx = context.WithValue(ctx, ContextKeyReceivedAt, req.ReceivedAt)
+	if req.RawWireID != nil {
+		ctx = context.WithValue(ctx, ContextKeyRawWireID, *req.RawWireID)
+	}
+	r = r.WithContext(ctx)
+
+	l := logrus.WithFields(logrus.Fields{
+		"endpoint":  r.URL.Path,
+		"service":   req.ServiceType,
+		"serviceId": req.Service.ID,
+		"spooled":   true,
+	})
+	_, rawWireID, err := processWebhook(l, req.ServiceType, monitoringService, discardResponseWriter{header: http.Header{}}, r)
+
+	// Keep the ID of the stored raw request for the next attempt
+	if err != nil && req.RawWireID == nil && !rawWireID.IsZero() {
+		req.RawWireID = &rawWireID
+		data, encodeErr := json.Marshal(req)
+		if encodeErr == nil {
+			encodeErr = writeFileSync(path, data)
+		}
+		if encodeErr != nil {
+			l.WithError(encodeErr).Warn("Could not record raw request in spool file")
+		}
+	}
+	return err
+}
+
+// remove deletes the spooled request once it was stored.
+func (s *Spool) remove(path string) {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logrus.WithError(err).Error("Could not remove spool file")
+	}
+
+	s.mu.Lock()
+	delete(s.entries, path)
+	s.mu.Unlock()
+}
+
+// moveToFailed moves the spooled request to the failed directory, where it can be inspected and moved back until
+// SpoolFailedRetention has passed.
+func (s *Spool) moveToFailed(path string) {
+	failedPath := filepath.Join(s.dir, spoolFailedDir, filepath.Base(path))
+	err := os.Rename(path, failedPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logrus.WithError(err).Error("Could not move spool file to the failed directory")
+	}
+	// The retention starts when the request failed, not when it was received
+	if err == nil {
+		now := time.Now()
+		os.Chtimes(failedPath, now, now)
+	}
+
+	s.mu.Lock()
+	delete(s.entries, path)
+	s.mu.Unlock()
+}
+
+// sweepFailed removes the requests from the failed directory that failed longer than SpoolFailedRetention ago.
+func (s *Spool) sweepFailed(now time.Time) {
+	if SpoolFailedRetention <= 0 {
+		return
+	}
+
+	paths, err := filepath.Glob(filepath.Join(s.dir, spoolFailedDir, "*"+spoolFileExt))
+	if err != nil {
+		logrus.WithError(err).Error("Could not read the failed directory of the spool")
+		return
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || now.Sub(info.ModTime()) < SpoolFailedRetention {
+			continue
+		}
+
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			logrus.WithError(err).Error("Could not remove failed spool file")
+			continue
+		}
+		logrus.WithField("spoolFile", filepath.Base(path)).Info("Removed failed spooled webhook")
+	}
+}
+
+// discardResponseWriter is the response writer for spooled requests, whose response was already sent.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d discardResponseWriter) Header() http.Header         { return d.header }
+func (d discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardResponseWriter) WriteHeader(statusCode int)  {}
+
+// SpoolMetrics is the endpoint that returns the metrics of the spool, such as the queue depth.
+func SpoolMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := SpoolStats{}
+	if s := activeSpool(); s != nil {
+		stats = s.Stats()
+	}
+	render.JSON(w, r, stats)
+}
@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryTautulliWebhook is the name of the repository for the Tautulli webhook
+	RepositoryTautulliWebhook = "tautulli"
+)
+
+func init() {
+	Register(RepositoryTautulliWebhook, TautulliMonitoringService{},
+		"play", "stop", "pause", "resume", "change", "buffer", "concurrent",
+	)
+}
+
+// TautulliMonitoringService is the struct for the Tautulli webhook
+type TautulliMonitoringService struct{}
+
+// TautulliWebhook parses the Tautulli notification (stream details for Plex playback) and stores it.
+func (tms TautulliMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Info("Firing webhook for Tautulli")
+
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	tautulliWebhookData := models.TautulliWebhookData{}
+	err = tautulliWebhookData.FromHTTPRequest(r)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, RepositoryTautulliWebhook, tautulliWebhookData.Envelope().EventType, body, tautulliWebhookData)
+
+	return StoreEvent(r, tautulliWebhookData)
+}
+
+// LegacyEvent returns the model the Tautulli events were stored as before events were stored in envelopes.
+func (tms TautulliMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.TautulliWebhookData{}
+}
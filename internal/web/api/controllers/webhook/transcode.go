@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositoryTdarrWebhook is the name of the repository for the Tdarr webhook
+	RepositoryTdarrWebhook = "tdarr"
+	// RepositoryUnmanicWebhook is the name of the repository for the Unmanic webhook
+	RepositoryUnmanicWebhook = "unmanic"
+
+	// pathMappingsConfigKey is the key of the service config that holds the transcoder to Servarr path mappings
+	pathMappingsConfigKey = "pathMappings"
+)
+
+func init() {
+	for _, client := range []string{RepositoryTdarrWebhook, RepositoryUnmanicWebhook} {
+		Register(client, TranscodeMonitoringService{client: client}, "success", "failure")
+	}
+}
+
+// TranscodeMonitoringService is the struct for the transcoder webhooks, which are normalized into one job event.
+type TranscodeMonitoringService struct {
+	client string
+}
+
+// TranscodeWebhook parses the result of the transcode job, maps its path onto the library and stores it.
+func (tms TranscodeMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Infof("Firing webhook for %s", tms.client)
+
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	transcodeJobEvent := models.TranscodeJobEvent{}
+	err = transcodeJobEvent.FromHTTPRequest(r, tms.client)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	// Keep track of the fields the model doesn't know about yet
+	recordSchemaDrift(l, r, tms.client, transcodeJobEvent.Envelope().EventType, body, transcodeJobEvent)
+
+	// The transcoder usually mounts the library somewhere else than the Servarr applications do
+	if service, ok := ServiceFromContext(r.Context()); ok {
+		transcodeJobEvent.MapPath(service.ConfigStringMap(pathMappingsConfigKey))
+	}
+
+	if !transcodeJobEvent.Success {
+		l.Warnf("Transcode of %s failed: %s", transcodeJobEvent.Path, transcodeJobEvent.Error)
+	}
+
+	return StoreEvent(r, transcodeJobEvent)
+}
+
+// LegacyEvent returns the model the transcoder events were stored as before events were stored in envelopes.
+func (tms TranscodeMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.TranscodeJobEvent{}
+}
@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"plex_monitor/internal/database/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RepositorySABnzbdWebhook is the name of the repository for the SABnzbd post-processing script
+	RepositorySABnzbdWebhook = "sabnzbd"
+	// RepositoryNZBGetWebhook is the name of the repository for the NZBGet post-processing script
+	RepositoryNZBGetWebhook = "nzbget"
+)
+
+func init() {
+	for _, client := range []string{RepositorySABnzbdWebhook, RepositoryNZBGetWebhook} {
+		Register(client, UsenetMonitoringService{client: client},
+			models.UsenetJobStatusCompleted, models.UsenetJobStatusFailed,
+		)
+	}
+}
+
+// UsenetMonitoringService is the struct for the Usenet client post-processing scripts, which are all normalized into a
+// UsenetJobEvent
+type UsenetMonitoringService struct {
+	client string
+}
+
+// UsenetWebhook parses the post-processing script variables of the Usenet client and stores the finished job.
+func (ums UsenetMonitoringService) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	l.Infof("Firing webhook for %s", ums.client)
+
+	usenetJobEvent := models.UsenetJobEvent{}
+	err := usenetJobEvent.FromHTTPRequest(r, ums.client)
+	if err != nil {
+		return fmt.Errorf("unable to parse request (%w): %s", ErrBadRequestData, err)
+	}
+
+	// Keep track of the script variables the client doesn't read
+	recordUnknownFields(l, r, ums.client, usenetJobEvent.Envelope().EventType, usenetJobEvent.UnknownFields())
+
+	if usenetJobEvent.Status == models.UsenetJobStatusFailed {
+		l.Warnf("Usenet job %s failed: %s", usenetJobEvent.JobName, usenetJobEvent.FailMessage)
+	}
+
+	return StoreEvent(r, usenetJobEvent)
+}
+
+// LegacyEvent returns the model the usenet downloader events were stored as before events were stored in envelopes.
+func (ums UsenetMonitoringService) LegacyEvent(eventType string) models.Event {
+	return &models.UsenetJobEvent{}
+}
@@ -1,9 +1,14 @@
 package webhook
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httputil"
+	"plex_monitor/internal/database"
 	"plex_monitor/internal/database/models"
 	"plex_monitor/internal/web/api"
 	"time"
@@ -11,8 +16,29 @@ import (
 	"github.com/go-chi/render"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type key string
+
+const (
+	// ContextKeyService is the key used to set the authenticated service in the HTTP context
+	ContextKeyService key = "Service"
+	// ContextKeyReceivedAt is the key used to set the time a spooled request was received in the HTTP context
+	ContextKeyReceivedAt key = "ReceivedAt"
+	// ContextKeyRawWireID is the key used to set the ID of the stored raw request in the HTTP context
+	ContextKeyRawWireID key = "RawWireID"
+
+	// ServiceKeyQueryParam is the query parameter that can be used to supply the webhook key
+	ServiceKeyQueryParam = "key"
+	// ServiceKeyHeader is the header that can be used to supply the webhook key
+	ServiceKeyHeader = "X-Webhook-Key"
+)
+
+// ErrBadRequestData is wrapped by the errors of service monitors that can't parse the request. Spooled requests that
+// fail with it aren't retried, since retrying can't fix them.
+var ErrBadRequestData = errors.New("bad request data")
+
 // Entry is the endpoint that handles the inital request for webhooks and routes down to the service-specific func.
 func Entry(w http.ResponseWriter, r *http.Request) {
 	l := logrus.WithFields(logrus.Fields{
@@ -29,20 +55,42 @@ func Entry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Store the raw request in the database as UTF-8
-	byts, _ := httputil.DumpRequest(r, true)
-	filename := fmt.Sprintf("%s_%s.txt", serviceType, time.Now().Format("2006-01-02_15:04:05"))
-	models.AddFileToBucket(models.RawRequestWiresBucket, filename, byts, bson.M{"service": serviceType, "event": r.URL.Query().Get("event")})
-
-	// Fire the hook for the given service, or return an error if the service is invalid
+	// Get the monitor for the given service, or return an error if the service is invalid
 	monitoringService := getService(serviceType)
 	if monitoringService.monitor == nil {
 		api.RenderError("Invalid service", l, w, r, nil)
 		return
 	}
 
-	// Fire the hook
-	err := monitoringService.fireHooks(l, w, r)
+	// Make sure the request carries a valid key for the service before anything is stored
+	service, err := authenticateService(l, serviceType, getServiceKey(r))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidServiceKey) {
+			api.RenderErrorWithStatus(http.StatusUnauthorized, "Invalid service key", l, w, r, nil)
+			return
+		}
+		api.RenderError("Unable to validate service key", l, w, r, err)
+		return
+	}
+	l = l.WithField("serviceId", service.ID)
+	r = r.WithContext(context.WithValue(r.Context(), ContextKeyService, service))
+
+	// When the spool is running, accept the request as soon as it is on disk and let the workers store it
+	if spool := activeSpool(); spool != nil {
+		err = spool.enqueue(serviceType, service, r)
+		if err == nil {
+			webhookResponse.Status = "accepted"
+			webhookResponse.Message = "Webhook queued"
+			webhookResponse.Success = true
+
+			render.Status(r, http.StatusAccepted)
+			render.JSON(w, r, webhookResponse)
+			return
+		}
+		l.WithError(err).Error("Could not spool webhook, processing it right away")
+	}
+
+	duplicate, _, err := processWebhook(l, serviceType, monitoringService, w, r)
 	if err != nil {
 		api.RenderError(fmt.Sprintf("There was an issue firing the webhook for service %s", serviceType), l, w, r, err)
 		return
@@ -52,13 +100,171 @@ func Entry(w http.ResponseWriter, r *http.Request) {
 	webhookResponse.Status = "success"
 	webhookResponse.Message = "Webhook fired successfully"
 	webhookResponse.Success = true
+	if duplicate {
+		webhookResponse.Message = "Duplicate webhook ignored"
+	}
 
 	render.JSON(w, r, webhookResponse)
 }
 
-// ServiceMonitor is the interface for the service-specific webhook functions.
+// processWebhook stores the raw request in the wires bucket and fires the service-specific hook for it. Duplicates of
+// webhooks that were already stored are only kept as raw requests, in which case true is returned. The ID of the raw
+// request is returned too, so retries can put it in the request context (see ContextKeyRawWireID) rather than storing
+// the raw request again.
+func processWebhook(l *logrus.Entry, serviceType string, monitoringService MonitoringService, w http.ResponseWriter, r *http.Request) (bool, primitive.ObjectID, error) {
+	// Rather store a duplicate than drop the webhook when the check fails
+	claim, claimed, err := claimWebhook(r)
+	if err != nil {
+		l.WithError(err).Error("Could not check for duplicate webhook")
+	}
+	hash := ""
+	if claim != nil {
+		hash = claim.Hash
+	}
+
+	// Store the raw request in the database as UTF-8 without its secrets, and link the parsed data to it. Retries
+	// already stored it.
+	rawWireID, stored := RawWireIDFromContext(r.Context())
+	if !stored {
+		r = storeRequestWire(l, serviceType, r, hash, claimed)
+		rawWireID, stored = RawWireIDFromContext(r.Context())
+	}
+	if stored {
+		l = l.WithField("rawWireId", rawWireID.Hex())
+	}
+
+	if !claimed {
+		l.WithField("dedupHash", hash).Info("Duplicate webhook, not storing it again")
+		setRawWireParseStatus(l, r, models.RawWireDuplicate, nil)
+		return true, rawWireID, nil
+	}
+
+	// Fire the hook, and commit the claim once the webhook was stored, or release it so the webhook can be retried
+	err = monitoringService.fireHooks(l, w, r)
+	if claim != nil && claimed {
+		if err != nil {
+			if releaseErr := claim.Release(); releaseErr != nil {
+				l.WithError(releaseErr).Error("Could not release dedup claim")
+			}
+		} else if commitErr := claim.Commit(); commitErr != nil {
+			l.WithError(commitErr).Error("Could not commit dedup claim")
+		}
+	}
+
+	if err != nil {
+		setRawWireParseStatus(l, r, models.RawWireFailed, err)
+	} else {
+		setRawWireParseStatus(l, r, models.RawWireParsed, nil)
+	}
+	return false, rawWireID, err
+}
+
+// storeRequestWire stores the raw request without its secrets, and its encrypted copy, and returns the request with
+// the ID of the raw request in its context. Failing to store it is logged, the webhook is still processed.
+func storeRequestWire(l *logrus.Entry, serviceType string, r *http.Request, hash string, claimed bool) *http.Request {
+	byts, err := Redaction.redactRequest(r)
+	if err != nil {
+		l.WithError(err).Error("Could not redact raw request")
+		return r
+	}
+
+	metadata := bson.M{"service": serviceType, "event": r.URL.Query().Get("event")}
+	if service, ok := ServiceFromContext(r.Context()); ok {
+		metadata["serviceId"] = service.ID
+	}
+	if hash != "" {
+		metadata["dedupHash"] = hash
+	}
+	if !claimed {
+		metadata["duplicate"] = true
+	}
+
+	rawWireID, err := models.StoreRawWire(serviceType, byts, receivedAt(r), metadata)
+	if err != nil {
+		l.WithError(err).Error("Could not store raw request")
+		return r
+	}
+	l = l.WithField("rawWireId", rawWireID.Hex())
+	r = r.WithContext(context.WithValue(r.Context(), ContextKeyRawWireID, rawWireID))
+	storeUnredactedRawWire(l, r, rawWireID)
+	return r
+}
+
+// storeUnredactedRawWire stores the raw request as it was received, encrypted, when an encryption key is configured.
+func storeUnredactedRawWire(l *logrus.Entry, r *http.Request, rawWireID primitive.ObjectID) {
+	if len(WireEncryptionKey) == 0 {
+		return
+	}
+
+	byts, err := httputil.DumpRequest(r, true)
+	if err == nil {
+		err = models.StoreUnredactedRawWire(rawWireID, byts, WireEncryptionKey)
+	}
+	if err != nil {
+		l.WithError(err).Error("Could not store unredacted raw request")
+	}
+}
+
+// setRawWireParseStatus records the parse status on the raw request of the webhook, which decides how long it is kept
+// (see StartWireSweeper).
+func setRawWireParseStatus(l *logrus.Entry, r *http.Request, status string, parseErr error) {
+	rawWireID, ok := RawWireIDFromContext(r.Context())
+	if !ok {
+		return
+	}
+
+	err := models.SetRawWireParseStatus(rawWireID, status, parseErr)
+	if err != nil {
+		l.WithError(err).Error("Could not set raw request parse status")
+	}
+}
+
+// getServiceKey returns the webhook key supplied with the request, either as a query parameter or a header.
+func getServiceKey(r *http.Request) string {
+	if k := r.URL.Query().Get(ServiceKeyQueryParam); k != "" {
+		return k
+	}
+	return r.Header.Get(ServiceKeyHeader)
+}
+
+// ReceivedAtFromContext returns the time the request was received, which is only added to the request context when it
+// is processed later than that (see StartSpool).
+func ReceivedAtFromContext(ctx context.Context) (time.Time, bool) {
+	receivedAt, ok := ctx.Value(ContextKeyReceivedAt).(time.Time)
+	return receivedAt, ok
+}
+
+// receivedAt returns the time the request was received.
+func receivedAt(r *http.Request) time.Time {
+	if t, ok := ReceivedAtFromContext(r.Context()); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// RawWireIDFromContext returns the ID of the raw request that was stored for the request by Entry.
+func RawWireIDFromContext(ctx context.Context) (primitive.ObjectID, bool) {
+	rawWireID, ok := ctx.Value(ContextKeyRawWireID).(primitive.ObjectID)
+	return rawWireID, ok
+}
+
+// ServiceFromContext returns the authenticated service that was added to the request context by Entry.
+func ServiceFromContext(ctx context.Context) (models.ServiceData, bool) {
+	service, ok := ctx.Value(ContextKeyService).(models.ServiceData)
+	return service, ok
+}
+
+// ServiceMonitor is the interface for the service-specific webhook functions. Fire is called with the authenticated
+// request (see ServiceFromContext) after the raw request was stored, and stores the events it parses with StoreEvent.
+// Services outside of this package implement it and add themselves with Register.
 type ServiceMonitor interface {
-	fire(*logrus.Entry, http.ResponseWriter, *http.Request) error
+	Fire(*logrus.Entry, http.ResponseWriter, *http.Request) error
+}
+
+// LegacyEventDecoder is implemented by the service monitors whose events were stored before events were stored in
+// envelopes. LegacyEvent returns the model the event of the supplied type was stored as, see WrapLegacyEvents.
+type LegacyEventDecoder interface {
+	LegacyEvent(eventType string) models.Event
 }
 
 // MonitoringService is the struct for the service-specific webhook functions.
@@ -69,28 +275,50 @@ type MonitoringService struct {
 // Run the data collection & storage.
 func (m MonitoringService) fireHooks(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
 	// Fire webhooks for specific service
-	return m.monitor.fire(l, w, r)
+	return m.monitor.Fire(l, w, r)
 }
 
-func getService(svcName string) MonitoringService {
-	switch svcName {
-	case RepositoryPlexName:
-		return MonitoringService{
-			monitor: PlexMonitoringService{},
-		}
-	case RepositoryRadarrWebhook:
-		return MonitoringService{
-			monitor: RadarrMonitoringService{},
-		}
-	case RepositorySonarrWebhook:
-		return MonitoringService{
-			monitor: SonarrMonitoringService{},
-		}
-	case RepositoryOmbiWebhook:
-		return MonitoringService{
-			monitor: OmbiMonitoringService{},
+// readBody reads the request body and sets it back on the request so it can be parsed again.
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse request body: %w", err)
+	}
+
+	r.Body = io.NopCloser(bytes.NewBuffer(body))
+	return body, nil
+}
+
+// StoreEvent stores the parsed webhook data in the webhook collection, wrapped in its event envelope and linked to the
+// service and raw request of the request (see insertWebhookData). Service monitors call it from Fire with the request
+// they were fired with.
+func StoreEvent(r *http.Request, data models.Event) error {
+	_, err := insertWebhookData(r, data)
+	return err
+}
+
+// insertWebhookData stores the parsed webhook data in the webhook collection, wrapped in its event envelope, and
+// returns the ID of the new document. The envelope links to the service the request was authenticated with and to the
+// raw request the data was parsed from, and requests that were processed after being spooled keep the time they were
+// received.
+func insertWebhookData(r *http.Request, data models.Event) (primitive.ObjectID, error) {
+	envelope := models.NewEventEnvelope(data, receivedAt(r))
+	if service, ok := ServiceFromContext(r.Context()); ok {
+		envelope.ServiceID = service.ID
+		// Not every service reports the name of its instance
+		if envelope.Instance == "" {
+			envelope.Instance = service.Instance
 		}
-	default:
-		return MonitoringService{}
 	}
+	if rawWireID, ok := RawWireIDFromContext(r.Context()); ok {
+		envelope.RawWireID = &rawWireID
+	}
+
+	result, err := database.DB.Collection(database.WebhookCollectionName).InsertOne(database.Ctx, envelope)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("could not store data: %w", err)
+	}
+
+	id, _ := result.InsertedID.(primitive.ObjectID)
+	return id, nil
 }
@@ -2,18 +2,26 @@ package webhook
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"plex_monitor/internal/database"
 	"plex_monitor/internal/database/models"
+	"plex_monitor/internal/utils"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func setup() {
@@ -32,6 +40,100 @@ func teardown() {
 	database.CloseDB()
 }
 
+const testServiceKey = "test-service-key"
+
+// createTestService registers a service of the given type that accepts testServiceKey.
+func createTestService(t *testing.T, serviceType string, keys ...models.ServiceKey) {
+	if len(keys) == 0 {
+		key, err := models.HashServiceKey(testServiceKey)
+		assert.NoError(t, err)
+		keys = append(keys, key)
+	}
+
+	_, err := database.DB.Collection(database.ServicesCollectionName).InsertOne(database.Ctx, models.ServiceData{
+		ID:          serviceType,
+		ServiceName: serviceType,
+		ServiceType: serviceType,
+		Keys:        keys,
+		CreatedAt:   time.Now(),
+		CreatedBy:   models.SystemUserID,
+		UpdatedAt:   time.Now(),
+		UpdatedBy:   models.SystemUserID,
+	})
+	assert.NoError(t, err)
+}
+
+// postWebhookFile sends the contents of the given file in the test directory to the webhook entrypoint for the service.
+func postWebhookFile(t *testing.T, serviceType string, filename string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", "/webhook?service="+serviceType+"&key="+testServiceKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Load json file and add it to the request body
+	contents, err := os.ReadFile("../../../../../test/" + filename)
+	assert.NoError(t, err)
+	req.Body = io.NopCloser(bytes.NewBuffer(contents))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// postWebhookFileField sends the contents of the test file in a field of a multipart form to the webhook entrypoint
+// for the service, like Emby does.
+func postWebhookFileField(t *testing.T, serviceType string, field string, filename string) *httptest.ResponseRecorder {
+	contents, err := os.ReadFile("../../../../../test/" + filename)
+	assert.NoError(t, err)
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	assert.NoError(t, w.WriteField(field, string(contents)))
+	w.Close()
+
+	req, err := http.NewRequest("POST", "/webhook?service="+serviceType+"&key="+testServiceKey, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// postWebhookForm sends the url encoded form to the webhook entrypoint for the service, like the download client
+// completion scripts do.
+func postWebhookForm(t *testing.T, serviceType string, form url.Values) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", "/webhook?service="+serviceType+"&key="+testServiceKey, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// findEventPayload decodes the payload of the stored event that matches the filter.
+func findEventPayload(filter bson.M, payload interface{}) error {
+	var event struct {
+		Payload bson.Raw `bson:"payload"`
+	}
+	err := database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, filter).Decode(&event)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(event.Payload, payload)
+}
+
 func TestWebhookWithInvalidService(t *testing.T) {
 	setup()
 	defer teardown()
@@ -64,11 +166,12 @@ func TestWebhookWithInvalidService(t *testing.T) {
 func TestWebhookWithPlexService(t *testing.T) {
 	setup()
 	defer teardown()
+	createTestService(t, "plex")
 
 	// Create a request to pass to our
 	// handler. We don't have any query parameters for now, so we'll
 	// pass 'nil' as the third parameter.
-	req, err := http.NewRequest("POST", "/webhook?service=plex", nil)
+	req, err := http.NewRequest("POST", "/webhook?service=plex&key="+testServiceKey, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -113,7 +216,12 @@ func TestWebhookWithPlexService(t *testing.T) {
 	}
 
 	// Assert that we stored the event in the database
-	evt, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"event": "media.pause"})
+	evt, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"payload.event": "media.pause"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), evt)
+
+	// Assert that the fields shared with the other media servers were filled in
+	evt, err = database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"payload.mediaServer.itemTitle": "Big Daddy", "payload.mediaServer.providerIds.tmdb": "9032"})
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), evt)
 
@@ -124,14 +232,42 @@ func TestWebhookWithPlexService(t *testing.T) {
 	assert.Equal(t, int64(1), raw)
 }
 
+func TestWebhookWithEmbyService(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "emby")
+
+	// Emby sends the data in a form field by default, newer versions can send a plain JSON body
+	rr := postWebhookFileField(t, "emby", "data", "emby_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = postWebhookFile(t, "emby", "emby_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that we stored the events in the database
+	evt, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"payload.Event": "playback.start"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), evt)
+
+	// Assert that the fields shared with the other media servers were filled in
+	evt, err = database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"payload.mediaServer.user": "grandma", "payload.mediaServer.itemTitle": "Big Daddy", "payload.mediaServer.providerIds.tmdb": "9032"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), evt)
+
+	// Assert that we captured the raw data
+	raw, err := models.CountFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "emby"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), raw)
+}
+
 func TestWebhookWithSonarrService(t *testing.T) {
 	setup()
 	defer teardown()
+	createTestService(t, "sonarr")
 
 	// Create a request to pass to our
 	// handler. We don't have any query parameters for now, so we'll
 	// pass 'nil' as the third parameter.
-	req, err := http.NewRequest("POST", "/webhook?service=sonarr", nil)
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr&key="+testServiceKey, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -159,7 +295,7 @@ func TestWebhookWithSonarrService(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	// Assert that we stored the event in the database
-	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"series.id": 73})
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"payload.series.id": 73})
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), count)
 
@@ -173,11 +309,12 @@ func TestWebhookWithSonarrService(t *testing.T) {
 func TestWebhookWithSonarrServiceHealth(t *testing.T) {
 	setup()
 	defer teardown()
+	createTestService(t, "sonarr")
 
 	// Create a request to pass to our
 	// handler. We don't have any query parameters for now, so we'll
 	// pass 'nil' as the third parameter.
-	req, err := http.NewRequest("POST", "/webhook?service=sonarr", nil)
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr&key="+testServiceKey, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -205,7 +342,7 @@ func TestWebhookWithSonarrServiceHealth(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	// Assert that we stored the event in the database
-	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"message": "Indexers unavailable due to failures: indexerName"})
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"payload.message": "Indexers unavailable due to failures: indexerName"})
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), count)
 
@@ -219,11 +356,12 @@ func TestWebhookWithSonarrServiceHealth(t *testing.T) {
 func TestWebhookWithRadarrService(t *testing.T) {
 	setup()
 	defer teardown()
+	createTestService(t, "radarr")
 
 	// Create a request to pass to our
 	// handler. We don't have any query parameters for now, so we'll
 	// pass 'nil' as the third parameter.
-	req, err := http.NewRequest("POST", "/webhook?service=radarr", nil)
+	req, err := http.NewRequest("POST", "/webhook?service=radarr&key="+testServiceKey, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -251,7 +389,7 @@ func TestWebhookWithRadarrService(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	// Assert that we stored the event in the database
-	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"movie.id": 686})
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"payload.movie.id": 686})
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), count)
 
@@ -265,11 +403,12 @@ func TestWebhookWithRadarrService(t *testing.T) {
 func TestWebhookWithRadarrServiceHealth(t *testing.T) {
 	setup()
 	defer teardown()
+	createTestService(t, "radarr")
 
 	// Create a request to pass to our
 	// handler. We don't have any query parameters for now, so we'll
 	// pass 'nil' as the third parameter.
-	req, err := http.NewRequest("POST", "/webhook?service=radarr", nil)
+	req, err := http.NewRequest("POST", "/webhook?service=radarr&key="+testServiceKey, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -297,7 +436,7 @@ func TestWebhookWithRadarrServiceHealth(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	// Assert that we stored the event in the database
-	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"message": "Indexers unavailable due to failures: indexerName"})
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"payload.message": "Indexers unavailable due to failures: indexerName"})
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), count)
 
@@ -308,14 +447,106 @@ func TestWebhookWithRadarrServiceHealth(t *testing.T) {
 	assert.Equal(t, int64(1), raw)
 }
 
+func TestWebhookWithLidarrAndReadarrServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  string
+		filename string
+		filter   bson.M
+	}{
+		{"lidarr grab", "lidarr", "lidarr_webhook_response_sample__on_grab.json", bson.M{"payload.artist.id": 42}},
+		{"lidarr health", "lidarr", "lidarr_webhook_response_sample_health_status.json", bson.M{"payload.message": "Indexers unavailable due to failures: indexerName"}},
+		{"readarr grab", "readarr", "readarr_webhook_response_sample__on_grab.json", bson.M{"payload.author.id": 12}},
+		{"readarr download", "readarr", "readarr_webhook_response_sample__on_download.json", bson.M{"payload.eventType": "Download", "payload.bookFiles.id": 301}},
+		{"readarr health", "readarr", "readarr_webhook_response_sample_health_status.json", bson.M{"payload.message": "Indexers unavailable due to failures: indexerName"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup()
+			defer teardown()
+			createTestService(t, tt.service)
+
+			rr := postWebhookFile(t, tt.service, tt.filename)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			// Assert that we stored the event in the database
+			tt.filter["service"] = tt.service
+			count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, tt.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), count)
+
+			// Assert that we captured the raw data
+			raw, err := models.CountFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": tt.service})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), raw)
+		})
+	}
+}
+
+func TestWebhookWithProwlarrServiceHealth(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "prowlarr")
+
+	rr := postWebhookFile(t, "prowlarr", "prowlarr_webhook_response_sample_health_status.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that the indexer failures were parsed out of the health message
+	var healthData models.ServarrHealthData
+	err := findEventPayload(bson.M{"service": "prowlarr"}, &healthData)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.IndexerFailure{
+		{Indexer: "Nzb.su", Check: "IndexerLongTermStatusCheck", Level: "error", LongTerm: true},
+		{Indexer: "DrunkenSlug", Check: "IndexerLongTermStatusCheck", Level: "error", LongTerm: true},
+	}, healthData.IndexerFailures)
+}
+
+func TestWebhookWithProwlarrGrabLinkedToSonarrGrab(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "prowlarr")
+	createTestService(t, "sonarr")
+
+	rr := postWebhookFile(t, "prowlarr", "prowlarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var prowlarrGrab bson.M
+	err := database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, bson.M{"service": "prowlarr"}).Decode(&prowlarrGrab)
+	assert.NoError(t, err)
+
+	// Assert that the Sonarr grab points at the Prowlarr grab of the same release
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"service": "sonarr", "payload.prowlarrGrabId": prowlarrGrab["_id"]})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestWebhookWithSonarrGrabLinkedToLaterProwlarrGrab(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "prowlarr")
+	createTestService(t, "sonarr")
+
+	rr := postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = postWebhookFile(t, "prowlarr", "prowlarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"service": "sonarr", "payload.prowlarrGrabId": bson.M{"$exists": true}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
 func TestWebhookWithOmbiService(t *testing.T) {
 	setup()
 	defer teardown()
+	createTestService(t, "ombi")
 
 	// Create a request to pass to our
 	// handler. We don't have any query parameters for now, so we'll
 	// pass 'nil' as the third parameter.
-	req, err := http.NewRequest("POST", "/webhook?service=ombi", nil)
+	req, err := http.NewRequest("POST", "/webhook?service=ombi&key="+testServiceKey, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -343,7 +574,7 @@ func TestWebhookWithOmbiService(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	// Assert that we stored the event in the database
-	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"requestId": "1234"})
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"payload.requestId": "1234"})
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), count)
 
@@ -353,3 +584,1325 @@ func TestWebhookWithOmbiService(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int64(1), raw)
 }
+
+func TestWebhookWithMissingKey(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sonarr")
+
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(bytes.NewBufferString(`{"eventType": "Test"}`))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+
+	// Assert that the request was rejected
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "{\"status\":\"error\",\"message\":\"Invalid service key\",\"success\":false}\n", rr.Body.String())
+
+	// Assert that nothing was stored
+	raw, err := models.CountFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "sonarr"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), raw)
+}
+
+func TestWebhookWithKeyHeader(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "ombi")
+
+	req, err := http.NewRequest("POST", "/webhook?service=ombi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(ServiceKeyHeader, testServiceKey)
+	req.Body = io.NopCloser(bytes.NewBufferString(`{"requestId": "1234", "notificationType": "Test"}`))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestWebhookWithRevokedKey(t *testing.T) {
+	setup()
+	defer teardown()
+
+	key, err := models.HashServiceKey(testServiceKey)
+	assert.NoError(t, err)
+	revokedAt := time.Now().Add(-time.Minute)
+	key.RevokedAt = &revokedAt
+	createTestService(t, "radarr", key)
+
+	req, err := http.NewRequest("POST", "/webhook?service=radarr&key="+testServiceKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(bytes.NewBufferString(`{"eventType": "Test"}`))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+
+	// Assert that the request was rejected and nothing was stored
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestWebhookWithRotatedKey(t *testing.T) {
+	setup()
+	defer teardown()
+
+	service, oldKey, err := models.CreateService("Ombi", "ombi", "main", nil, models.SystemUserID)
+	assert.NoError(t, err)
+	newKey, expiresAt, err := service.RotateKey(time.Hour, models.SystemUserID)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+	assert.Equal(t, expiresAt, *service.Keys[0].ExpiresAt)
+
+	// Both keys should be accepted while the old key is in its grace period
+	for _, k := range []string{oldKey, newKey} {
+		req, err := http.NewRequest("POST", "/webhook?service=ombi&key="+k, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Body = io.NopCloser(bytes.NewBufferString(`{"requestId": "1234", "notificationType": "Test"}`))
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Entry)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	// Without a grace period the old keys stop working immediately
+	_, _, err = service.RotateKey(0, models.SystemUserID)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/webhook?service=ombi&key="+newKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(bytes.NewBufferString(`{"requestId": "1234", "notificationType": "Test"}`))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestWebhookWithOverseerrService(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "overseerr")
+
+	rr := postWebhookFile(t, "overseerr", "overseerr_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that the request was stored with the same fields Ombi requests use
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{
+		"service":                  "overseerr",
+		"payload.requestId":        "5678",
+		"payload.requestedUser":    "family",
+		"payload.notificationType": "RequestDeclined",
+		"payload.denyReason":       "Already available in 4K",
+		"payload.providerId":       "9032",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	// Assert that we captured the raw data
+	raw, err := models.CountFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "overseerr"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), raw)
+}
+
+func TestWebhookWithJellyseerrServiceIssue(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "jellyseerr")
+
+	rr := postWebhookFile(t, "jellyseerr", "overseerr_webhook_response_sample__issue_comment.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{
+		"service":                  "jellyseerr",
+		"payload.notificationType": "IssueComment",
+		"payload.issueSubject":     "Big Daddy (1999)",
+		"payload.issueCategory":    "AUDIO",
+		"payload.issueUser":        "family",
+		"payload.newIssueComment":  "Still happening on the living room TV.",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestWebhookWithJellyfinService(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "jellyfin")
+
+	rr := postWebhookFile(t, "jellyfin", "jellyfin_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that the event was stored with the fields shared with the other media servers
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{
+		"service":                              "jellyfin",
+		"payload.NotificationType":             "PlaybackStart",
+		"payload.mediaServer.user":             "grandma",
+		"payload.mediaServer.player":           "Living Room TV",
+		"payload.mediaServer.itemType":         "movie",
+		"payload.mediaServer.providerIds.tmdb": "9032",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestWebhookWithTautulliService(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "tautulli")
+
+	rr := postWebhookFile(t, "tautulli", "tautulli_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that the quoted numbers were decoded and the shared media server fields were filled in
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{
+		"service":                              "tautulli",
+		"payload.action":                       "change",
+		"payload.transcode_decision":           "transcode",
+		"payload.stream_bandwidth":             8124,
+		"payload.season_num":                   0,
+		"payload.mediaServer.user":             "grandma",
+		"payload.mediaServer.itemType":         "movie",
+		"payload.mediaServer.providerIds.tmdb": "9032",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestWebhookWithDownloadClientServices(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// The same sample data the scripts in test/ post
+	tests := []struct {
+		client       string
+		form         url.Values
+		category     string
+		savePath     string
+		expectedSize int64
+	}{
+		{
+			client: "deluge",
+			form: url.Values{
+				"torrent_id":    {"0c1a8f6a3e6d7c4f0b1e9d2a5c3b4e6f7a8d9c0b"},
+				"torrent_name":  {"Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF"},
+				"download_path": {"/downloads/complete/tv"},
+			},
+			savePath: "/downloads/complete/tv",
+		},
+		{
+			client: "transmission",
+			form: url.Values{
+				"TR_TORRENT_HASH":             {"0c1a8f6a3e6d7c4f0b1e9d2a5c3b4e6f7a8d9c0b"},
+				"TR_TORRENT_NAME":             {"Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF"},
+				"TR_TORRENT_DIR":              {"/downloads/complete"},
+				"TR_TORRENT_LABELS":           {"tv-sonarr,classic"},
+				"TR_TORRENT_BYTES_DOWNLOADED": {"864583973"},
+			},
+			category:     "tv-sonarr",
+			savePath:     "/downloads/complete",
+			expectedSize: 864583973,
+		},
+		{
+			client: "qbittorrent",
+			form: url.Values{
+				"hash":         {"0c1a8f6a3e6d7c4f0b1e9d2a5c3b4e6f7a8d9c0b"},
+				"name":         {"Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF"},
+				"category":     {"tv-sonarr"},
+				"save_path":    {"/downloads/complete/tv-sonarr"},
+				"content_path": {"/downloads/complete/tv-sonarr/Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF"},
+				"size":         {"864583973"},
+			},
+			category:     "tv-sonarr",
+			savePath:     "/downloads/complete/tv-sonarr",
+			expectedSize: 864583973,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.client, func(t *testing.T) {
+			createTestService(t, tt.client)
+
+			rr := postWebhookForm(t, tt.client, tt.form)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			// Assert that the hash was stored as the upper case downloadId the Servarr applications report
+			event := models.DownloadClientEvent{}
+			err := findEventPayload(bson.M{"service": tt.client, "category": models.EventCategoryDownload, "action": "complete"}, &event)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.client, event.Client)
+			assert.Equal(t, "0C1A8F6A3E6D7C4F0B1E9D2A5C3B4E6F7A8D9C0B", event.DownloadID)
+			assert.Equal(t, "Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF", event.Name)
+			assert.Equal(t, tt.category, event.Category)
+			assert.Equal(t, tt.savePath, event.SavePath)
+			assert.Equal(t, tt.expectedSize, event.Size)
+		})
+	}
+}
+
+func TestWebhookWithDownloadClientMissingHash(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "deluge")
+
+	rr := postWebhookForm(t, "deluge", url.Values{"torrent_name": {"Some.Torrent"}})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestWebhookWithSABnzbdServiceFailedJob(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sabnzbd")
+
+	rr := postWebhookForm(t, "sabnzbd", url.Values{
+		"SAB_NZO_ID":        {"SABnzbd_nzo_x5g_kvk5"},
+		"SAB_FILENAME":      {"Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF"},
+		"SAB_CAT":           {"tv"},
+		"SAB_PP_STATUS":     {"-1"},
+		"SAB_FAIL_MSG":      {"Aborted, cannot be completed"},
+		"SAB_DOWNLOAD_TIME": {"312"},
+		"SAB_BYTES":         {"864583973"},
+	})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that the job can be found with the downloadId of the Sonarr grab that started it
+	job := models.UsenetJobEvent{}
+	err := findEventPayload(bson.M{"service": "sabnzbd", "category": models.EventCategoryDownload, "payload.downloadId": "SABnzbd_nzo_x5g_kvk5"}, &job)
+	assert.NoError(t, err)
+	assert.Equal(t, models.UsenetJobStatusFailed, job.Status)
+	assert.Equal(t, "Aborted, cannot be completed", job.FailMessage)
+	assert.Equal(t, "Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF", job.JobName)
+	assert.Equal(t, "tv", job.Category)
+	assert.Equal(t, int64(312), job.DownloadTime)
+	assert.Equal(t, int64(864583973), job.Size)
+}
+
+func TestWebhookWithNZBGetServiceJSON(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "nzbget")
+
+	rr := postWebhookFile(t, "nzbget", "nzbget_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	job := models.UsenetJobEvent{}
+	err := findEventPayload(bson.M{"service": "nzbget"}, &job)
+	assert.NoError(t, err)
+	assert.Equal(t, "1337", job.DownloadID)
+	assert.Equal(t, models.UsenetJobStatusFailed, job.Status)
+	assert.Equal(t, "unpack", job.FailMessage)
+	assert.Equal(t, int64(1)<<32+569616421, job.Size)
+}
+
+func TestWebhookWithBazarrServiceLinkedToSonarr(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sonarr")
+	createTestService(t, "bazarr")
+
+	rr := postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = postWebhookFile(t, "bazarr", "bazarr_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that the subtitle details were parsed from the message and keyed by the Sonarr IDs
+	event := models.BazarrWebhookData{}
+	err := findEventPayload(bson.M{"service": "bazarr"}, &event)
+	assert.NoError(t, err)
+	assert.Equal(t, "downloaded", event.Action)
+	assert.Equal(t, "episode", event.MediaType)
+	assert.Equal(t, "English", event.Language)
+	assert.True(t, event.HearingImpaired)
+	assert.Equal(t, "opensubtitles", event.Provider)
+	assert.Equal(t, 96.67, event.Score)
+	assert.Equal(t, "Doctor Who", event.SeriesTitle)
+	assert.Equal(t, 16, event.SeasonNumber)
+	assert.Equal(t, 2, event.EpisodeNumber)
+	assert.Equal(t, 73, event.SonarrSeriesID)
+	assert.Equal(t, 5664, event.SonarrEpisodeID)
+}
+
+func TestWebhookWithTdarrServicePathMapping(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "tdarr")
+
+	// Tdarr mounts the library at /media, Radarr at /movies
+	_, err := database.DB.Collection(database.ServicesCollectionName).UpdateOne(database.Ctx, bson.M{"_id": "tdarr"}, bson.M{
+		"$set": bson.M{"config": bson.M{"pathMappings": bson.M{"/media/movies": "/movies", "/media": "/data"}}},
+	})
+	assert.NoError(t, err)
+
+	rr := postWebhookFile(t, "tdarr", "tdarr_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	job := models.TranscodeJobEvent{}
+	err = findEventPayload(bson.M{"service": "tdarr"}, &job)
+	assert.NoError(t, err)
+	assert.Equal(t, "/movies/Big Daddy (1999)/Big Daddy (1999) Bluray-1080p.mkv", job.Path)
+	assert.Equal(t, "hevc", job.NewCodec)
+	assert.True(t, bool(job.Success))
+	assert.Equal(t, int64(8589934592-3221225472), job.SpaceSaved)
+	assert.Equal(t, models.FlexibleInt(1843), job.Duration)
+}
+
+func TestWebhookWithAutobrrService(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "autobrr")
+	createTestService(t, "sonarr")
+
+	// The filter's webhook action fires on the announce, the notification once the release was pushed to Sonarr
+	rr := postWebhookFile(t, "autobrr", "autobrr_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = postWebhookFile(t, "autobrr", "autobrr_webhook_response_sample__push_approved.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	for _, actionResult := range []string{models.AutobrrActionResultMatched, "PUSH_APPROVED"} {
+		release := models.AutobrrWebhookData{}
+		err := findEventPayload(bson.M{"service": "autobrr", "payload.actionResult": actionResult}, &release)
+		assert.NoError(t, err)
+		assert.Equal(t, "Classic TV", release.FilterName)
+		assert.Equal(t, "nzbsu", release.Indexer)
+		assert.Equal(t, models.FlexibleInt(864583973), release.Size)
+		assert.Equal(t, "0C1A8F6A3E6D7C4F0B1E9D2A5C3B4E6F7A8D9C0B", release.DownloadID)
+	}
+
+	// Assert that the release can be followed to the Sonarr grab
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{
+		"$or": []bson.M{
+			{"service": "autobrr", "payload.releaseTitle": "Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF"},
+			{"service": "sonarr", "payload.release.releaseTitle": "Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestWebhookWithGenericServiceMappings(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "generic")
+
+	// Map the fields of an Uptime Kuma notification
+	_, err := database.DB.Collection(database.ServicesCollectionName).UpdateOne(database.Ctx, bson.M{"_id": "generic"}, bson.M{
+		"$set": bson.M{"config": bson.M{"mappings": bson.M{
+			"eventType": "monitor.type",
+			"title":     "$.monitor.name",
+			"user":      "monitor.tags[0].name",
+			"severity":  "heartbeat.status",
+			"timestamp": "heartbeat.time",
+		}}},
+	})
+	assert.NoError(t, err)
+
+	rr := postWebhookFile(t, "generic", "generic_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	event := models.GenericWebhookData{}
+	err = findEventPayload(bson.M{"service": "generic"}, &event)
+	assert.NoError(t, err)
+	assert.Equal(t, "generic", event.ServiceID)
+	assert.Equal(t, "http", event.EventType)
+	assert.Equal(t, "Plex", event.Title)
+	assert.Equal(t, "media", event.User)
+	assert.Equal(t, "0", event.Severity)
+	if assert.NotNil(t, event.Timestamp) {
+		assert.True(t, event.Timestamp.Equal(time.Date(2023, 8, 5, 20, 15, 0, 0, time.UTC)))
+	}
+	assert.Equal(t, "[Plex] [🔴 Down] connect ECONNREFUSED 10.0.0.5:32400", event.Payload["msg"])
+}
+
+// customMonitor is a service monitor defined outside of the built-in services, like an in-house one would be.
+type customMonitor struct {
+	fired *bool
+}
+
+func (cm customMonitor) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	*cm.fired = true
+	return nil
+}
+
+func TestRegisterCustomService(t *testing.T) {
+	setup()
+	defer teardown()
+
+	fired := false
+	Register("custom", customMonitor{fired: &fired}, "ping")
+	createTestService(t, "custom")
+
+	rr := postWebhookFile(t, "custom", "generic_webhook_response_sample.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, fired)
+
+	// Assert that the service is listed with its event types
+	assert.Contains(t, Services(), ServiceDescription{Name: "custom", EventTypes: []string{"ping"}})
+}
+
+// deployEvent is the event of a service defined outside of the built-in services.
+type deployEvent struct {
+	Version string `json:"version" bson:"version"`
+}
+
+func (e deployEvent) Envelope() models.EventEnvelope {
+	return models.EventEnvelope{Service: "deployer", Action: "deploy", EventType: "deploy"}
+}
+
+// deployMonitor is a service monitor outside of the built-in services that stores its events.
+type deployMonitor struct{}
+
+func (dm deployMonitor) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	event := deployEvent{}
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		return err
+	}
+	return StoreEvent(r, event)
+}
+
+func TestRegisterCustomServiceStoresEvent(t *testing.T) {
+	setup()
+	defer teardown()
+
+	Register("deployer", deployMonitor{}, "deploy")
+	createTestService(t, "deployer")
+
+	req, err := http.NewRequest("POST", "/webhook?service=deployer&key="+testServiceKey, strings.NewReader(`{"version": "1.2.3"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that the event was wrapped in its envelope and linked to the service and raw request
+	var envelope models.EventEnvelope
+	err = database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, bson.M{"service": "deployer"}).Decode(&envelope)
+	assert.NoError(t, err)
+	assert.Equal(t, "deployer", envelope.ServiceID)
+	assert.Equal(t, models.EventCategoryOther, envelope.Category)
+	assert.NotNil(t, envelope.RawWireID)
+
+	event := deployEvent{}
+	assert.NoError(t, findEventPayload(bson.M{"service": "deployer"}, &event))
+	assert.Equal(t, "1.2.3", event.Version)
+}
+
+func TestRegisterDuplicateService(t *testing.T) {
+	assert.Panics(t, func() {
+		Register(RepositorySonarrWebhook, SonarrMonitoringService{})
+	})
+}
+
+func TestServicesListsBuiltInServices(t *testing.T) {
+	names := []string{}
+	for _, service := range Services() {
+		names = append(names, service.Name)
+	}
+
+	assert.Subset(t, names, models.ServiceTypes)
+	assert.IsIncreasing(t, names)
+
+	// Assert that the built-in services are the service types the CLI creates services for, leaving out the services
+	// the other tests register
+	builtIn := []string{}
+	for _, name := range names {
+		if name != "custom" && name != "deployer" && name != "flaky" {
+			builtIn = append(builtIn, name)
+		}
+	}
+	assert.Equal(t, models.ServiceTypes, builtIn)
+}
+
+// waitForSpool waits until the spool has no requests left.
+func waitForSpool(t *testing.T, s *Spool) {
+	assert.Eventually(t, func() bool { return s.Stats().Depth == 0 }, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestWebhookWithSpool(t *testing.T) {
+	setup()
+	defer teardown()
+	WireEncryptionKey = bytes.Repeat([]byte{7}, 32)
+	defer func() { WireEncryptionKey = nil }()
+	createTestService(t, "sonarr")
+
+	s, err := StartSpool(t.TempDir(), 2)
+	assert.NoError(t, err)
+	defer s.Stop()
+
+	rr := postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	// Assert that the workers stored the request
+	waitForSpool(t, s)
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"service": "sonarr"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, int64(1), s.Stats().Processed)
+}
+
+// flakyMonitor is a service monitor that fails the first time it is fired.
+type flakyMonitor struct {
+	fired *int
+}
+
+func (fm flakyMonitor) Fire(l *logrus.Entry, w http.ResponseWriter, r *http.Request) error {
+	*fm.fired++
+	if *fm.fired == 1 {
+		return fmt.Errorf("temporary failure")
+	}
+	return nil
+}
+
+func TestSpoolRetryReusesRawWire(t *testing.T) {
+	setup()
+	defer teardown()
+	WireEncryptionKey = bytes.Repeat([]byte{7}, 32)
+	defer func() { WireEncryptionKey = nil }()
+
+	fired := 0
+	Register("flaky", flakyMonitor{fired: &fired})
+	createTestService(t, "flaky")
+
+	s, err := StartSpool(t.TempDir(), 1)
+	assert.NoError(t, err)
+	defer s.Stop()
+
+	rr := postWebhookFile(t, "flaky", "generic_webhook_response_sample.json")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	// Assert that the retry stored the webhook without storing its raw request again
+	waitForSpool(t, s)
+	assert.Equal(t, 2, fired)
+	assert.Equal(t, int64(1), s.Stats().Retried)
+	count, err := models.CountFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "flaky"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestSpoolDrainsExistingRequests(t *testing.T) {
+	dir := t.TempDir()
+	WireEncryptionKey = bytes.Repeat([]byte{7}, 32)
+	defer func() { WireEncryptionKey = nil }()
+
+	// A request for a service that doesn't exist can never be stored, so it is moved to the failed directory
+	data, err := json.Marshal(spooledRequest{
+		ServiceType: "unknown",
+		ReceivedAt:  time.Now(),
+	})
+	assert.NoError(t, err)
+	name := fmt.Sprintf("%020d_unknown_test%s", time.Now().UnixNano(), spoolFileExt)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+
+	s, err := StartSpool(dir, 1)
+	assert.NoError(t, err)
+	defer s.Stop()
+
+	waitForSpool(t, s)
+	assert.FileExists(t, filepath.Join(dir, spoolFailedDir, name))
+	assert.NoFileExists(t, filepath.Join(dir, name))
+	assert.Equal(t, int64(1), s.Stats().Failed)
+}
+
+func TestSpoolFailsBadRequestData(t *testing.T) {
+	setup()
+	defer teardown()
+	WireEncryptionKey = bytes.Repeat([]byte{7}, 32)
+	defer func() { WireEncryptionKey = nil }()
+	createTestService(t, "sonarr")
+
+	dir := t.TempDir()
+	s, err := StartSpool(dir, 1)
+	assert.NoError(t, err)
+	defer s.Stop()
+
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr&key="+testServiceKey, strings.NewReader("not json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	// Assert that the request that can't be parsed was not retried
+	waitForSpool(t, s)
+	assert.Equal(t, int64(1), s.Stats().Failed)
+	assert.Equal(t, int64(0), s.Stats().Retried)
+	failed, err := filepath.Glob(filepath.Join(dir, spoolFailedDir, "*"+spoolFileExt))
+	assert.NoError(t, err)
+	assert.Len(t, failed, 1)
+}
+
+func TestSpoolBackoff(t *testing.T) {
+	assert.Equal(t, spoolMinBackoff, spoolBackoff(1))
+	assert.Equal(t, 4*spoolMinBackoff, spoolBackoff(3))
+	assert.Equal(t, spoolMaxBackoff, spoolBackoff(100))
+}
+
+func TestSpoolRequiresEncryptionKey(t *testing.T) {
+	_, err := StartSpool(t.TempDir(), 1)
+	assert.Error(t, err)
+	assert.Nil(t, activeSpool())
+}
+
+func TestSpoolEncryptsSpooledRequests(t *testing.T) {
+	s := &Spool{dir: t.TempDir(), queue: make(chan string, 1), entries: map[string]*spoolEntry{}}
+
+	WireEncryptionKey = bytes.Repeat([]byte{7}, 32)
+	defer func() { WireEncryptionKey = nil }()
+
+	body := `{"eventType": "Test", "downloadClient": {"apiKey": "secret-api-key"}}`
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr&key="+testServiceKey, strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("X-Plex-Token", "plex-token")
+	assert.NoError(t, s.enqueue("sonarr", models.ServiceData{ID: "sonarr"}, req))
+
+	// Assert that the secrets are only on disk encrypted
+	path := <-s.queue
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	for _, secret := range []string{testServiceKey, "plex-token", "secret-api-key"} {
+		assert.NotContains(t, string(data), secret)
+	}
+
+	spooled := spooledRequest{}
+	assert.NoError(t, json.Unmarshal(data, &spooled))
+	wire, err := utils.Decrypt(WireEncryptionKey, spooled.EncryptedWire)
+	assert.NoError(t, err)
+	assert.Contains(t, string(wire), "key="+testServiceKey)
+}
+
+func TestSpoolSweepsFailedRequests(t *testing.T) {
+	s := &Spool{dir: t.TempDir(), entries: map[string]*spoolEntry{}}
+	assert.NoError(t, os.MkdirAll(filepath.Join(s.dir, spoolFailedDir), 0o700))
+
+	old := filepath.Join(s.dir, spoolFailedDir, "old"+spoolFileExt)
+	recent := filepath.Join(s.dir, spoolFailedDir, "recent"+spoolFileExt)
+	assert.NoError(t, os.WriteFile(old, []byte("{}"), 0o600))
+	assert.NoError(t, os.WriteFile(recent, []byte("{}"), 0o600))
+	failedAt := time.Now().Add(-SpoolFailedRetention - time.Hour)
+	assert.NoError(t, os.Chtimes(old, failedAt, failedAt))
+
+	s.sweepFailed(time.Now())
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, recent)
+}
+
+func TestWebhookWithDuplicatePayload(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sonarr")
+
+	rr := postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Duplicate webhook ignored")
+
+	// Assert that the webhook was stored once, and both raw requests were kept
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"service": "sonarr"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	raw, err := models.CountFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "sonarr"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), raw)
+	raw, err = models.CountFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "sonarr", "metadata.duplicate": true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), raw)
+
+	// Assert that the identical requests got their own wires, and that the event links to the first one
+	files, err := models.ListFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "sonarr"})
+	assert.NoError(t, err)
+	if assert.Len(t, files, 2) {
+		assert.NotEqual(t, files[0]["filename"], files[1]["filename"])
+		assert.Equal(t, files[0]["metadata"].(bson.M)["sha256"], files[1]["metadata"].(bson.M)["sha256"])
+
+		count, err = database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"rawWireId": files[0]["_id"]})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+	}
+}
+
+func TestWebhookWithIdempotencyKey(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "ombi")
+
+	// The payloads differ, but the idempotency key marks them as the same webhook
+	for _, body := range []string{`{"requestId": "1234", "notificationType": "Test"}`, `{"requestId": "1234", "notificationType": "Test", "retry": 1}`} {
+		req, err := http.NewRequest("POST", "/webhook?service=ombi&key="+testServiceKey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(IdempotencyKeyHeader, "ombi-1234")
+		req.Body = io.NopCloser(bytes.NewBufferString(body))
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Entry)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"service": "ombi"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestWebhookWithReplayHeader(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "ombi")
+
+	// The replay of a stored webhook is stored again
+	for _, replay := range []string{"", "true"} {
+		req, err := http.NewRequest("POST", "/webhook?service=ombi", bytes.NewBufferString(`{"requestId": "1234", "notificationType": "Test"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(ServiceKeyHeader, testServiceKey)
+		if replay != "" {
+			req.Header.Set(ReplayHeader, replay)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Entry)
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "Duplicate webhook ignored")
+	}
+
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"service": "ombi"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestWebhookWithLostDedupClaim(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "ombi")
+
+	post := func() {
+		req, err := http.NewRequest("POST", "/webhook?service=ombi&key="+testServiceKey, bytes.NewBufferString(`{"requestId": "1234", "notificationType": "Test"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(IdempotencyKeyHeader, "ombi-1234")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Entry)
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+	post()
+
+	// Assert that the claim was committed once the webhook was stored
+	claims := database.DB.Collection(database.DedupCollectionName)
+	claim := models.DedupClaim{}
+	assert.NoError(t, claims.FindOne(database.Ctx, bson.M{"idempotencyKey": "ombi-1234"}).Decode(&claim))
+	assert.True(t, claim.Committed)
+
+	// A claim that was never committed, like that of a webhook lost in a crash, is taken over once it is stale
+	update := bson.M{"$set": bson.M{"committed": false, "claimedAt": time.Now().Add(-2 * models.DedupClaimTimeout)}}
+	_, err := claims.UpdateOne(database.Ctx, bson.M{"idempotencyKey": "ombi-1234"}, update)
+	assert.NoError(t, err)
+	post()
+
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"service": "ombi"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestNormalizedPayload(t *testing.T) {
+	req, err := http.NewRequest("POST", "/webhook", bytes.NewBufferString("{\n  \"b\": 1,\n  \"a\": {\"d\": 2.50, \"c\": null}\n}"))
+	assert.NoError(t, err)
+	payload, err := normalizedPayload(req)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":{"c":null,"d":2.50},"b":1}`, string(payload))
+
+	// Uploaded files are left out of multipart forms
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	assert.NoError(t, writer.WriteField("payload", `{"event": "media.play", "user": true}`))
+	part, err := writer.CreateFormFile("thumb", "thumb.jpg")
+	assert.NoError(t, err)
+	part.Write([]byte("jpeg"))
+	assert.NoError(t, writer.Close())
+
+	req, err = http.NewRequest("POST", "/webhook", body)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	payload, err = normalizedPayload(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "payload=%7B%22event%22%3A%22media.play%22%2C%22user%22%3Atrue%7D", string(payload))
+}
+
+// postPlexWebhook sends the Plex sample payload with the supplied event and thumbnail, like Plex does.
+func postPlexWebhook(t *testing.T, event string, thumb []byte) *httptest.ResponseRecorder {
+	payload, err := os.ReadFile("../../../../../test/plex_webhook_response_sample.json")
+	assert.NoError(t, err)
+	payload = bytes.Replace(payload, []byte(`"media.pause"`), []byte(`"`+event+`"`), 1)
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	assert.NoError(t, w.WriteField("payload", string(payload)))
+	fw, err := w.CreateFormFile("thumb", "thumb.jpg")
+	assert.NoError(t, err)
+	_, err = fw.Write(thumb)
+	assert.NoError(t, err)
+	w.Close()
+
+	req, err := http.NewRequest("POST", "/webhook?service=plex&key="+testServiceKey, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestWebhookWithPlexServiceThumbnail(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "plex")
+
+	thumb := append([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), make([]byte, 64)...)
+	assert.Equal(t, http.StatusOK, postPlexWebhook(t, "media.play", thumb).Code)
+	assert.Equal(t, http.StatusOK, postPlexWebhook(t, "media.pause", thumb).Code)
+
+	// Assert that both events link to the thumbnail, which was stored once
+	hash, err := models.StoreThumbnail(thumb)
+	assert.NoError(t, err)
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{"service": "plex", "payload.thumbnailHash": hash})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	files, err := models.CountFilesInBucket(models.ThumbnailsBucket, bson.M{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), files)
+}
+
+func TestWebhookWithSonarrServiceSchemaDrift(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sonarr")
+
+	// Add fields the model doesn't know about, like a newer Sonarr version would send
+	contents, err := os.ReadFile("../../../../../test/sonarr_webhook_response_sample__on_grab.json")
+	assert.NoError(t, err)
+	payload := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(contents, &payload))
+	payload["customFormatInfo"] = map[string]interface{}{"customFormatScore": 10, "apiKey": "secret-api-key"}
+	payload["series"].(map[string]interface{})["originalLanguage"] = "English"
+	payload["indexerHost"] = "203.0.113.7"
+	body, err := json.Marshal(payload)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr&key="+testServiceKey, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that only the unknown fields were recorded, with an example value without its secrets
+	drift, err := models.GetSchemaDrift(bson.M{"serviceName": "sonarr"})
+	assert.NoError(t, err)
+	fields := map[string]interface{}{}
+	for _, d := range drift {
+		assert.Equal(t, "Grab", d.EventType)
+		assert.Equal(t, int64(1), d.Count)
+		fields[d.Field] = d.ExampleValue
+	}
+	assert.Len(t, fields, 3)
+	assert.Equal(t, "English", fields["series.originalLanguage"])
+	assert.Equal(t, "203.0.113.x", fields["indexerHost"])
+	assert.Contains(t, fields, "customFormatInfo")
+	assert.NotContains(t, fmt.Sprint(fields["customFormatInfo"]), "secret-api-key")
+}
+
+func TestRedactField(t *testing.T) {
+	assert.Equal(t, redactedValue, Redaction.redactField("apikey", "secret-api-key"))
+	assert.Equal(t, "203.0.113.x", Redaction.redactField("tracker", "203.0.113.7"))
+	assert.Equal(t, "tracker.example.org", Redaction.redactField("tracker", "tracker.example.org"))
+}
+
+func TestWebhookSchemaDriftForEveryService(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "jellyfin")
+	createTestService(t, "qbittorrent")
+
+	// A JSON body with a field the model doesn't know about
+	contents, err := os.ReadFile("../../../../../test/jellyfin_webhook_response_sample.json")
+	assert.NoError(t, err)
+	payload := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(contents, &payload))
+	payload["PlaybackSpeed"] = 1.5
+	body, err := json.Marshal(payload)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/webhook?service=jellyfin&key="+testServiceKey, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// A completion script that posts a form field the client doesn't read
+	rr = postWebhookForm(t, "qbittorrent", url.Values{
+		"hash":    {"0c1a8f6a3e6d7c4f0b1e9d2a5c3b4e6f7a8d9c0b"},
+		"name":    {"Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF"},
+		"tracker": {"tracker.example.org"},
+	})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	drift, err := models.GetSchemaDrift(bson.M{"serviceName": "jellyfin"})
+	assert.NoError(t, err)
+	assert.Len(t, drift, 1)
+	assert.Equal(t, "PlaybackSpeed", drift[0].Field)
+	assert.Equal(t, "PlaybackStart", drift[0].EventType)
+
+	drift, err = models.GetSchemaDrift(bson.M{"serviceName": "qbittorrent"})
+	assert.NoError(t, err)
+	assert.Len(t, drift, 1)
+	assert.Equal(t, "tracker", drift[0].Field)
+	assert.Equal(t, "tracker.example.org", drift[0].ExampleValue)
+}
+
+func TestWebhookRawWireCompression(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sonarr")
+
+	rr := postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that the wire was stored compressed with its parse status, and is read back as it was received
+	files, err := models.ListFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "sonarr"})
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		metadata := files[0]["metadata"].(bson.M)
+		assert.Equal(t, "gzip", metadata["compression"])
+		assert.Equal(t, models.RawWireParsed, metadata["parseStatus"])
+		assert.Equal(t, "sonarr", metadata["serviceId"])
+
+		wire, err := models.GetFileFromBucket(models.RawRequestWiresBucket, files[0]["filename"].(string))
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(wire), "POST /webhook?service=sonarr"))
+		assert.Less(t, files[0]["length"], int64(len(wire)))
+	}
+}
+
+func TestWireSweeperRetention(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sonarr")
+
+	_, err := database.DB.Collection(database.ServicesCollectionName).UpdateOne(database.Ctx, bson.M{"_id": "sonarr"}, bson.M{"$set": bson.M{
+		"config": bson.M{"wireRetention": bson.M{"days": 30, "failedOnly": true}},
+	}})
+	assert.NoError(t, err)
+
+	// One webhook is stored, the other one can't be parsed
+	assert.Equal(t, http.StatusOK, postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json").Code)
+	assert.Equal(t, http.StatusBadRequest, postWebhookForm(t, "sonarr", url.Values{"eventType": {"Grab"}}).Code)
+
+	// Only the wire of the failed webhook is kept, until it expires
+	sweepWires(time.Now())
+	files, err := models.ListFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "sonarr"})
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, models.RawWireFailed, files[0]["metadata"].(bson.M)["parseStatus"])
+	}
+
+	sweepWires(time.Now().AddDate(0, 0, 31))
+	count, err := models.CountFilesInBucket(models.RawRequestWiresBucket, bson.M{"metadata.service": "sonarr"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestRedactRequest(t *testing.T) {
+	body := `{"eventType": "Test", "downloadClient": {"name": "SABnzbd", "apiKey": "secret-api-key"}, "message": "Connected to 10.0.0.5:8080"}`
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr&key="+testServiceKey, strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+	wire, err := DefaultRedaction().redactRequest(req)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(wire), testServiceKey)
+	assert.NotContains(t, string(wire), "secret-token")
+	assert.NotContains(t, string(wire), "secret-api-key")
+	assert.Contains(t, string(wire), "POST /webhook?service=sonarr&key=%5BREDACTED%5D")
+	assert.Contains(t, string(wire), "X-Forwarded-For: 203.0.113.x")
+	assert.Contains(t, string(wire), `"message":"Connected to 10.0.0.x:8080"`)
+
+	// The request itself is left as it was
+	parsed, err := readBody(req)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(parsed))
+	assert.Equal(t, "Bearer secret-token", req.Header.Get("Authorization"))
+}
+
+func TestRedactRequestMultipart(t *testing.T) {
+	thumb := []byte("\xff\xd8\xff\xe0 203.0.113.7")
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	assert.NoError(t, w.WriteField("payload", `{"event": "media.play", "Player": {"publicAddress": "2001:db8:1:2::7", "title": "TV"}}`))
+	fw, err := w.CreateFormFile("thumb", "thumb.jpg")
+	assert.NoError(t, err)
+	fw.Write(thumb)
+	w.Close()
+
+	req, err := http.NewRequest("POST", "/webhook?service=plex&X-Plex-Token=plex-token", &b)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	rc := DefaultRedaction()
+	rc.JSONPaths = append(rc.JSONPaths, "Player.title")
+	wire, err := rc.redactRequest(req)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(wire), "plex-token")
+	assert.Contains(t, string(wire), `"publicAddress":"2001:db8:1::x"`)
+	assert.Contains(t, string(wire), `"title":"[REDACTED]"`)
+	// Uploaded files are kept as they are
+	assert.Contains(t, string(wire), string(thumb))
+}
+
+func TestWebhookWithEncryptedUnredactedWire(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sonarr")
+
+	WireEncryptionKey = bytes.Repeat([]byte{7}, 32)
+	defer func() { WireEncryptionKey = nil }()
+
+	rr := postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample__on_grab.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	event := bson.M{}
+	err := database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, bson.M{"service": "sonarr"}).Decode(&event)
+	assert.NoError(t, err)
+	rawWireID := event["rawWireId"].(primitive.ObjectID)
+
+	// The stored wire is redacted, the encrypted copy is not
+	wire, err := models.GetRawWire(rawWireID)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(wire), testServiceKey)
+
+	unredacted, err := models.GetUnredactedRawWire(rawWireID, WireEncryptionKey)
+	assert.NoError(t, err)
+	assert.Contains(t, string(unredacted), "key="+testServiceKey)
+
+	_, err = models.GetUnredactedRawWire(rawWireID, bytes.Repeat([]byte{8}, 32))
+	assert.Error(t, err)
+}
+
+func TestWebhookEventEnvelope(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "plex")
+	createTestService(t, "radarr")
+	createTestService(t, "jellyfin")
+
+	assert.Equal(t, http.StatusOK, postPlexWebhook(t, "media.play", nil).Code)
+	assert.Equal(t, http.StatusOK, postWebhookFile(t, "radarr", "radarr_webhook_response_sample__on_grab.json").Code)
+	assert.Equal(t, http.StatusOK, postWebhookFile(t, "jellyfin", "jellyfin_webhook_response_sample.json").Code)
+
+	// Playback from both media servers can be queried with the same fields
+	count, err := database.DB.Collection(database.WebhookCollectionName).CountDocuments(database.Ctx, bson.M{
+		"category":   models.EventCategoryPlayback,
+		"action":     "play",
+		"media.tmdb": "9032",
+		"serviceId":  bson.M{"$in": []string{"plex", "jellyfin"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	var envelope models.EventEnvelope
+	err = database.DB.Collection(database.WebhookCollectionName).FindOne(database.Ctx, bson.M{"service": "jellyfin"}).Decode(&envelope)
+	assert.NoError(t, err)
+	assert.Equal(t, "jellyfin", envelope.Instance)
+	assert.Equal(t, "grandma", envelope.Actor)
+	assert.Equal(t, "PlaybackStart", envelope.EventType)
+	assert.Equal(t, &models.EventMedia{Type: "movie", Title: "Big Daddy", Year: 1999, ProviderIDs: models.ProviderIDs{Tmdb: "9032", Imdb: "tt0142342"}}, envelope.Media)
+	assert.True(t, envelope.OccurredAt.Equal(time.Date(2023, 8, 2, 0, 15, 0, 0, time.UTC)))
+	assert.NotNil(t, envelope.RawWireID)
+
+	// The typed payload is kept underneath the envelope
+	radarr := models.RadarrWebhookData{}
+	err = findEventPayload(bson.M{"category": models.EventCategoryGrab, "action": "grab", "media.type": "movie", "media.tmdb": "1234"}, &radarr)
+	assert.NoError(t, err)
+	assert.Equal(t, "Grab", radarr.EventType)
+	assert.Equal(t, 1234, radarr.Movie.TmdbID)
+}
+
+func TestWebhookServarrHealthIssueLifecycle(t *testing.T) {
+	setup()
+	defer teardown()
+	createTestService(t, "sonarr")
+
+	// Send the same health check twice, it should be tracked as a single open issue
+	DedupWindow = 0
+	defer func() { DedupWindow = DefaultDedupWindow }()
+	assert.Equal(t, http.StatusOK, postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample_health_status.json").Code)
+	assert.Equal(t, http.StatusOK, postWebhookFile(t, "sonarr", "sonarr_webhook_response_sample_health_status.json").Code)
+
+	issues, err := models.GetHealthIssues(bson.M{"serviceName": "sonarr", "open": true}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, issues, 1)
+	assert.Equal(t, "IndexerStatusCheck", issues[0].Type)
+	assert.Equal(t, "warning", issues[0].Level)
+	assert.Equal(t, "sonarr", issues[0].ServiceID)
+	assert.Equal(t, int64(2), issues[0].Occurrences)
+	assert.NotNil(t, issues[0].OpenedBy)
+
+	// The health check passes again
+	contents, err := os.ReadFile("../../../../../test/sonarr_webhook_response_sample_health_status.json")
+	assert.NoError(t, err)
+	contents = bytes.Replace(contents, []byte(`"eventType": "Health"`), []byte(`"eventType": "HealthRestored"`), 1)
+	req, err := http.NewRequest("POST", "/webhook?service=sonarr&key="+testServiceKey, bytes.NewReader(contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Entry)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Assert that the issue is listed as closed, with the event that closed it and its duration
+	req, err = http.NewRequest("GET", "/health?status=closed&service=sonarr", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler = http.HandlerFunc(ListHealthIssues)
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	response := map[string][]models.HealthIssue{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response["data"], 1)
+	closed := response["data"][0]
+	assert.False(t, closed.Open)
+	assert.NotNil(t, closed.ClosedAt)
+	assert.NotNil(t, closed.ClosedBy)
+	assert.GreaterOrEqual(t, closed.DurationSeconds, int64(0))
+	assert.Equal(t, issues[0].ID, closed.ID)
+
+	issues, err = models.GetHealthIssues(bson.M{"open": true}, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, issues)
+}
+
+func TestHealthIssueOutOfOrderAndAmbiguousRestore(t *testing.T) {
+	setup()
+	defer teardown()
+
+	health := func(eventType string, message string) models.ServarrHealthData {
+		return models.ServarrHealthData{ServiceName: "sonarr", EventType: eventType, Type: "IndexerStatusCheck", Message: message, Level: "warning"}
+	}
+	start := time.Date(2023, 8, 2, 0, 0, 0, 0, time.UTC)
+
+	// The restore is processed before the Health event it resolves, so the issue is closed right away
+	assert.NoError(t, models.TrackHealthIssue(health(models.ServarrHealthRestoredEvent, "Indexer A failed"), "sonarr", "", nil, start.Add(time.Minute)))
+	assert.NoError(t, models.TrackHealthIssue(health(models.ServarrHealthEvent, "Indexer A failed"), "sonarr", "", nil, start))
+	issues, err := models.GetHealthIssues(bson.M{"serviceName": "sonarr"}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, issues, 1)
+	assert.False(t, issues[0].Open)
+	assert.Equal(t, int64(60), issues[0].DurationSeconds)
+
+	// Failing after the restore opens the issue again
+	assert.NoError(t, models.TrackHealthIssue(health(models.ServarrHealthEvent, "Indexer A failed"), "sonarr", "", nil, start.Add(2*time.Minute)))
+	assert.NoError(t, models.TrackHealthIssue(health(models.ServarrHealthEvent, "Indexer B failed"), "sonarr", "", nil, start.Add(2*time.Minute)))
+	issues, err = models.GetHealthIssues(bson.M{"open": true}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, issues, 2)
+
+	// A restore whose message matches no open issue can't tell which of the issues of its type it resolves
+	assert.NoError(t, models.TrackHealthIssue(health(models.ServarrHealthRestoredEvent, "Indexers failed"), "sonarr", "", nil, start.Add(3*time.Minute)))
+	issues, err = models.GetHealthIssues(bson.M{"open": true}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, issues, 2)
+
+	// A matching message closes only its own issue, after which the last open issue of the type is closed by any restore
+	assert.NoError(t, models.TrackHealthIssue(health(models.ServarrHealthRestoredEvent, "Indexer A failed"), "sonarr", "", nil, start.Add(4*time.Minute)))
+	issues, err = models.GetHealthIssues(bson.M{"open": true}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, issues, 1)
+	assert.Equal(t, "Indexer B failed", issues[0].Message)
+
+	assert.NoError(t, models.TrackHealthIssue(health(models.ServarrHealthRestoredEvent, "Indexers failed"), "sonarr", "", nil, start.Add(5*time.Minute)))
+	issues, err = models.GetHealthIssues(bson.M{"open": true}, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, issues)
+}
+
+func TestLegacyEvent(t *testing.T) {
+	assert.IsType(t, &models.SonarrWebhookData{}, legacyEvent("sonarr", "Grab"))
+	assert.IsType(t, &models.ServarrHealthData{}, legacyEvent("radarr", "HealthRestored"))
+	assert.IsType(t, &models.DownloadClientEvent{}, legacyEvent("qbittorrent", "complete"))
+	assert.Nil(t, legacyEvent("unknown", "Test"))
+}
+
+func TestWrapLegacyEvents(t *testing.T) {
+	setup()
+	defer teardown()
+
+	createdAt := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	collection := database.DB.Collection(database.WebhookCollectionName)
+	_, err := collection.InsertMany(database.Ctx, []interface{}{
+		bson.M{"serviceName": "sonarr", "eventType": "Grab", "createdAt": createdAt},
+		bson.M{"serviceName": "unknown", "eventType": "Test", "createdAt": createdAt},
+	})
+	assert.NoError(t, err)
+
+	wrapped, err := WrapLegacyEvents()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, wrapped)
+
+	// Assert that the events are found by the fields of the envelope
+	envelope := models.EventEnvelope{}
+	err = collection.FindOne(database.Ctx, bson.M{"service": "sonarr"}).Decode(&envelope)
+	assert.NoError(t, err)
+	assert.Equal(t, models.EventCategoryGrab, envelope.Category)
+	assert.True(t, createdAt.Equal(envelope.ReceivedAt))
+	count, err := collection.CountDocuments(database.Ctx, bson.M{"receivedAt": createdAt})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
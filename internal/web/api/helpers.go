@@ -16,6 +16,11 @@ type StatusResponse struct {
 
 // RenderError is a helper function to render an error response and log the error.
 func RenderError(errorMessage string, l *logrus.Entry, w http.ResponseWriter, r *http.Request, err error) StatusResponse {
+	return RenderErrorWithStatus(http.StatusBadRequest, errorMessage, l, w, r, err)
+}
+
+// RenderErrorWithStatus is a helper function to render an error response with the supplied status code and log the error.
+func RenderErrorWithStatus(status int, errorMessage string, l *logrus.Entry, w http.ResponseWriter, r *http.Request, err error) StatusResponse {
 	// Log the error
 	l.WithFields(logrus.Fields{
 		"error": err,
@@ -27,7 +32,7 @@ func RenderError(errorMessage string, l *logrus.Entry, w http.ResponseWriter, r
 	response.Status = "error"
 	response.Message = errorMessage
 	response.Success = false
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(status)
 
 	// Return the response
 	render.JSON(w, r, response)
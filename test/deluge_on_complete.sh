@@ -0,0 +1,11 @@
+#!/bin/sh
+# Deluge Execute plugin script for the "Torrent Complete" event. Deluge calls it with the torrent id (info hash),
+# name and download path. Running it without arguments posts sample data.
+PLEX_MONITOR_URL="${PLEX_MONITOR_URL:-http://localhost:8080}"
+PLEX_MONITOR_KEY="${PLEX_MONITOR_KEY:-test-service-key}"
+
+curl -s -X POST "$PLEX_MONITOR_URL/api/v1/webhook?service=deluge" \
+  -H "X-Webhook-Key: $PLEX_MONITOR_KEY" \
+  --data-urlencode "torrent_id=${1:-0c1a8f6a3e6d7c4f0b1e9d2a5c3b4e6f7a8d9c0b}" \
+  --data-urlencode "torrent_name=${2:-Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF}" \
+  --data-urlencode "download_path=${3:-/downloads/complete/tv}"
@@ -0,0 +1,26 @@
+#!/bin/sh
+# NZBGet post-processing script. NZBGet passes the job details as NZBPP_* environment variables. Running it outside of
+# NZBGet posts sample data for a successful job.
+
+###########################################
+### NZBGET POST-PROCESSING SCRIPT       ###
+# Posts the finished job to Plex Monitor.
+###########################################
+
+PLEX_MONITOR_URL="${PLEX_MONITOR_URL:-http://localhost:8080}"
+PLEX_MONITOR_KEY="${PLEX_MONITOR_KEY:-test-service-key}"
+
+curl -s -X POST "$PLEX_MONITOR_URL/api/v1/webhook?service=nzbget" \
+  -H "X-Webhook-Key: $PLEX_MONITOR_KEY" \
+  --data-urlencode "NZBPP_NZBID=${NZBPP_NZBID:-1337}" \
+  --data-urlencode "NZBPP_NZBNAME=${NZBPP_NZBNAME:-Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF}" \
+  --data-urlencode "NZBPP_CATEGORY=${NZBPP_CATEGORY:-tv}" \
+  --data-urlencode "NZBPP_DIRECTORY=${NZBPP_DIRECTORY:-/downloads/complete/tv/Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF}" \
+  --data-urlencode "NZBPP_STATUS=${NZBPP_STATUS:-SUCCESS/ALL}" \
+  --data-urlencode "NZBPP_TOTALSTATUS=${NZBPP_TOTALSTATUS:-SUCCESS}" \
+  --data-urlencode "NZBPP_DOWNLOADTIME=${NZBPP_DOWNLOADTIME:-312}" \
+  --data-urlencode "NZBPP_FILESIZELO=${NZBPP_FILESIZELO:-864583973}" \
+  --data-urlencode "NZBPP_FILESIZEHI=${NZBPP_FILESIZEHI:-0}"
+
+# Tell NZBGet the script succeeded (POSTPROCESS_SUCCESS)
+exit 93
@@ -0,0 +1,15 @@
+#!/bin/sh
+# qBittorrent "Run external program on torrent finished" script. Configure it as:
+#   /scripts/qbittorrent_on_complete.sh "%I" "%N" "%L" "%D" "%F" "%Z"
+# Running it without arguments posts sample data.
+PLEX_MONITOR_URL="${PLEX_MONITOR_URL:-http://localhost:8080}"
+PLEX_MONITOR_KEY="${PLEX_MONITOR_KEY:-test-service-key}"
+
+curl -s -X POST "$PLEX_MONITOR_URL/api/v1/webhook?service=qbittorrent" \
+  -H "X-Webhook-Key: $PLEX_MONITOR_KEY" \
+  --data-urlencode "hash=${1:-0c1a8f6a3e6d7c4f0b1e9d2a5c3b4e6f7a8d9c0b}" \
+  --data-urlencode "name=${2:-Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF}" \
+  --data-urlencode "category=${3:-tv-sonarr}" \
+  --data-urlencode "save_path=${4:-/downloads/complete/tv-sonarr}" \
+  --data-urlencode "content_path=${5:-/downloads/complete/tv-sonarr/Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF}" \
+  --data-urlencode "size=${6:-864583973}"
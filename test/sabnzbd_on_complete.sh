@@ -0,0 +1,20 @@
+#!/bin/sh
+# SABnzbd post-processing script. SABnzbd passes the job details as SAB_* environment variables. Running it outside of
+# SABnzbd posts sample data for a failed job.
+PLEX_MONITOR_URL="${PLEX_MONITOR_URL:-http://localhost:8080}"
+PLEX_MONITOR_KEY="${PLEX_MONITOR_KEY:-test-service-key}"
+
+curl -s -X POST "$PLEX_MONITOR_URL/api/v1/webhook?service=sabnzbd" \
+  -H "X-Webhook-Key: $PLEX_MONITOR_KEY" \
+  --data-urlencode "SAB_NZO_ID=${SAB_NZO_ID:-SABnzbd_nzo_x5g_kvk5}" \
+  --data-urlencode "SAB_FILENAME=${SAB_FILENAME:-Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF}" \
+  --data-urlencode "SAB_FINAL_NAME=${SAB_FINAL_NAME:-Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF}" \
+  --data-urlencode "SAB_CAT=${SAB_CAT:-tv}" \
+  --data-urlencode "SAB_COMPLETE_DIR=${SAB_COMPLETE_DIR:-/downloads/complete/tv/Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF}" \
+  --data-urlencode "SAB_PP_STATUS=${SAB_PP_STATUS:--1}" \
+  --data-urlencode "SAB_FAIL_MSG=${SAB_FAIL_MSG:-Aborted, cannot be completed}" \
+  --data-urlencode "SAB_DOWNLOAD_TIME=${SAB_DOWNLOAD_TIME:-312}" \
+  --data-urlencode "SAB_BYTES=${SAB_BYTES:-864583973}"
+
+# The script's exit code is reported by SABnzbd, so always succeed
+exit 0
@@ -0,0 +1,14 @@
+#!/bin/sh
+# Transmission "script-torrent-done-filename" script. Transmission passes the torrent details as TR_TORRENT_*
+# environment variables. Running it outside of Transmission posts sample data.
+PLEX_MONITOR_URL="${PLEX_MONITOR_URL:-http://localhost:8080}"
+PLEX_MONITOR_KEY="${PLEX_MONITOR_KEY:-test-service-key}"
+
+curl -s -X POST "$PLEX_MONITOR_URL/api/v1/webhook?service=transmission" \
+  -H "X-Webhook-Key: $PLEX_MONITOR_KEY" \
+  --data-urlencode "TR_TORRENT_HASH=${TR_TORRENT_HASH:-0c1a8f6a3e6d7c4f0b1e9d2a5c3b4e6f7a8d9c0b}" \
+  --data-urlencode "TR_TORRENT_NAME=${TR_TORRENT_NAME:-Doctor.Who.S16E02.The.Pirate.Planet.EXTRAS.DVDRip.XviD-aAF}" \
+  --data-urlencode "TR_TORRENT_DIR=${TR_TORRENT_DIR:-/downloads/complete}" \
+  --data-urlencode "TR_TORRENT_LABELS=${TR_TORRENT_LABELS:-tv-sonarr,classic}" \
+  --data-urlencode "TR_TORRENT_BYTES_DOWNLOADED=${TR_TORRENT_BYTES_DOWNLOADED:-864583973}" \
+  --data-urlencode "TR_TORRENT_ID=${TR_TORRENT_ID:-42}"